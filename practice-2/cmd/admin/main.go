@@ -0,0 +1,460 @@
+// Command admin manages the API keys and users the server reads, working
+// on the same SQLite databases directly:
+//
+//	admin keys create -name ci -tenant team-a -scopes users:read -expires 720h
+//	admin keys list
+//	admin keys revoke <id>
+//	admin keys expire <id> [-at 2025-01-01T00:00:00Z | -in 24h | -never]
+//	admin keys scopes <id> users:read,users:write
+//	admin users create -name Alice -email alice@example.com -tenant team-a
+//	admin users delete <id> [-tenant team-a]
+//
+// The key database comes from -keys-db or API_KEYS_DB and the user database
+// from -db or DB_PATH. With -json every command prints JSON for scripts.
+// A new key's secret is printed once by "keys create" and never stored.
+//
+// Revoking, expiring or rescoping a key applies to the next X-API-Key
+// request, gRPC call or token refresh. Access tokens already issued from the
+// key keep their scopes until they expire, JWT_EXPIRY after issue.
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"tiny-http/internal/apikey"
+	"tiny-http/internal/repository"
+	"tiny-http/internal/tenant"
+	"tiny-http/internal/validate"
+)
+
+const usage = `usage: admin [-keys-db path] [-db path] [-json] <command> [args]
+
+commands:
+  keys create -name NAME [-id ID] [-tenant TENANT] [-scopes SCOPES] [-expires DURATION|TIME]
+  keys list
+  keys revoke ID
+  keys expire ID [-at TIME | -in DURATION | -never]
+  keys scopes ID SCOPES
+  users create -name NAME [-email EMAIL] [-tenant TENANT]
+  users delete ID [-tenant TENANT]
+
+SCOPES is a comma-separated list of %s.
+TIME is RFC 3339, e.g. 2025-01-01T00:00:00Z. TENANT defaults to %q;
+users delete finds the user in any tenant unless -tenant is given.
+
+revoke, expire and scopes apply to the next API key request, gRPC call or
+token refresh; access tokens already issued live until JWT_EXPIRY.
+
+flags:
+`
+
+// errUsage reports bad arguments; main prints the usage text for it
+var errUsage = errors.New("invalid arguments")
+
+// cli holds the global flags and where output goes
+type cli struct {
+	keysDB  string
+	usersDB string
+	json    bool
+	out     io.Writer
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	c := &cli{out: stdout}
+	fset := flag.NewFlagSet("admin", flag.ContinueOnError)
+	fset.SetOutput(stderr)
+	fset.StringVar(&c.keysDB, "keys-db", os.Getenv("API_KEYS_DB"), "SQLite API key database (API_KEYS_DB)")
+	fset.StringVar(&c.usersDB, "db", os.Getenv("DB_PATH"), "SQLite user database (DB_PATH)")
+	fset.BoolVar(&c.json, "json", false, "print JSON")
+	fset.Usage = func() {
+		fmt.Fprintf(stderr, usage, strings.Join(apikey.AllScopes, ", "), tenant.Default)
+		fset.PrintDefaults()
+	}
+	if err := fset.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	err := c.dispatch(context.Background(), fset.Args())
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errUsage):
+		fmt.Fprintln(stderr, "admin:", err)
+		fset.Usage()
+		return 2
+	default:
+		fmt.Fprintln(stderr, "admin:", err)
+		return 1
+	}
+}
+
+// dispatch runs the "<group> <command>" in args
+func (c *cli) dispatch(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	rest := args[2:]
+	switch args[0] + " " + args[1] {
+	case "keys create":
+		return c.keysCreate(ctx, rest)
+	case "keys list":
+		return c.keysList(ctx, rest)
+	case "keys revoke":
+		return c.keysRevoke(ctx, rest)
+	case "keys expire":
+		return c.keysExpire(ctx, rest)
+	case "keys scopes":
+		return c.keysScopes(ctx, rest)
+	case "users create":
+		return c.usersCreate(ctx, rest)
+	case "users delete":
+		return c.usersDelete(ctx, rest)
+	}
+	return fmt.Errorf("%w: unknown command %q", errUsage, args[0]+" "+args[1])
+}
+
+// openKeys opens the key database
+func (c *cli) openKeys() (*apikey.SQLiteStore, error) {
+	if c.keysDB == "" {
+		return nil, fmt.Errorf("%w: set -keys-db or API_KEYS_DB", errUsage)
+	}
+	return apikey.NewSQLiteStore(c.keysDB)
+}
+
+// openUsers opens the user database
+func (c *cli) openUsers() (*repository.SQLiteUserRepository, error) {
+	if c.usersDB == "" {
+		return nil, fmt.Errorf("%w: set -db or DB_PATH", errUsage)
+	}
+	return repository.NewSQLiteUserRepository(c.usersDB)
+}
+
+// parseFlags parses a subcommand's flags, which may come before or after
+// its positional arguments, and returns exactly positional arguments
+func parseFlags(fset *flag.FlagSet, args []string, positional int) ([]string, error) {
+	fset.SetOutput(io.Discard)
+	var pos []string
+	for {
+		if err := fset.Parse(args); err != nil {
+			return nil, fmt.Errorf("%w: %v", errUsage, err)
+		}
+		args = fset.Args()
+		if len(args) == 0 {
+			break
+		}
+		pos = append(pos, args[0])
+		args = args[1:]
+	}
+	if len(pos) != positional {
+		return nil, fmt.Errorf("%w: %s takes %d argument(s), got %d", errUsage, fset.Name(), positional, len(pos))
+	}
+	return pos, nil
+}
+
+// parseScopes splits a comma-separated scope list and rejects unknown ones
+func parseScopes(v string) ([]string, error) {
+	var scopes []string
+	for _, s := range strings.Split(v, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !slices.Contains(apikey.AllScopes, s) {
+			return nil, fmt.Errorf("%w: unknown scope %q", errUsage, s)
+		}
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes, nil
+}
+
+// parseWhen reads an RFC 3339 time or a duration from now
+func parseWhen(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil && d > 0 {
+		return time.Now().Add(d), nil
+	}
+	return time.Time{}, fmt.Errorf("%w: %q is neither an RFC 3339 time nor a positive duration", errUsage, v)
+}
+
+// newKeyID returns a random key id
+func newKeyID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return "key_" + hex.EncodeToString(b)
+}
+
+// createdKey is the output of "keys create", the only time the secret is
+// shown
+type createdKey struct {
+	apikey.Key
+	Secret string `json:"secret"`
+}
+
+func (c *cli) keysCreate(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("keys create", flag.ContinueOnError)
+	name := fset.String("name", "", "who or what the key is for")
+	id := fset.String("id", "", "key id (random if empty)")
+	tenantID := fset.String("tenant", tenant.Default, "tenant whose users the key can reach")
+	scopeList := fset.String("scopes", apikey.ScopeUsersRead, "comma-separated scopes")
+	expires := fset.String("expires", "", "RFC 3339 time or duration from now (never if empty)")
+	if _, err := parseFlags(fset, args, 0); err != nil {
+		return err
+	}
+	if *name == "" {
+		return fmt.Errorf("%w: keys create needs -name", errUsage)
+	}
+	scopes, err := parseScopes(*scopeList)
+	if err != nil {
+		return err
+	}
+	k := apikey.Key{ID: *id, Name: *name, Tenant: *tenantID, Scopes: scopes}
+	if k.ID == "" {
+		k.ID = newKeyID()
+	}
+	if *expires != "" {
+		if k.ExpiresAt, err = parseWhen(*expires); err != nil {
+			return err
+		}
+	}
+
+	store, err := c.openKeys()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	secret := apikey.NewSecret()
+	k.Hash = apikey.HashSecret(secret)
+	k, err = store.Create(ctx, k)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(createdKey{Key: k, Secret: secret})
+	}
+	c.printKeys([]apikey.Key{k})
+	fmt.Fprintf(c.out, "\nsecret: %s\nStore it now; it can't be shown again.\n", secret)
+	return nil
+}
+
+func (c *cli) keysList(ctx context.Context, args []string) error {
+	if _, err := parseFlags(flag.NewFlagSet("keys list", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	store, err := c.openKeys()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	keys, err := store.List(ctx)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(keys)
+	}
+	c.printKeys(keys)
+	return nil
+}
+
+func (c *cli) keysRevoke(ctx context.Context, args []string) error {
+	pos, err := parseFlags(flag.NewFlagSet("keys revoke", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	}
+	return c.updateKey(func(s *apikey.SQLiteStore) (apikey.Key, error) {
+		return s.Revoke(ctx, pos[0])
+	})
+}
+
+func (c *cli) keysExpire(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("keys expire", flag.ContinueOnError)
+	at := fset.String("at", "", "RFC 3339 time to expire at")
+	in := fset.String("in", "", "duration from now to expire in")
+	never := fset.Bool("never", false, "remove the expiry")
+	pos, err := parseFlags(fset, args, 1)
+	if err != nil {
+		return err
+	}
+
+	when := time.Now()
+	switch {
+	case (*at != "") && (*in != "") || *never && (*at != "" || *in != ""):
+		return fmt.Errorf("%w: use only one of -at, -in and -never", errUsage)
+	case *never:
+		when = time.Time{}
+	case *at != "":
+		if when, err = time.Parse(time.RFC3339, *at); err != nil {
+			return fmt.Errorf("%w: -at: %v", errUsage, err)
+		}
+	case *in != "":
+		d, err := time.ParseDuration(*in)
+		if err != nil || d < 0 {
+			return fmt.Errorf("%w: -in: %q is not a duration", errUsage, *in)
+		}
+		when = when.Add(d)
+	}
+	return c.updateKey(func(s *apikey.SQLiteStore) (apikey.Key, error) {
+		return s.SetExpiry(ctx, pos[0], when)
+	})
+}
+
+func (c *cli) keysScopes(ctx context.Context, args []string) error {
+	pos, err := parseFlags(flag.NewFlagSet("keys scopes", flag.ContinueOnError), args, 2)
+	if err != nil {
+		return err
+	}
+	scopes, err := parseScopes(pos[1])
+	if err != nil {
+		return err
+	}
+	return c.updateKey(func(s *apikey.SQLiteStore) (apikey.Key, error) {
+		return s.SetScopes(ctx, pos[0], scopes)
+	})
+}
+
+// updateKey opens the key store, applies change and prints the result
+func (c *cli) updateKey(change func(*apikey.SQLiteStore) (apikey.Key, error)) error {
+	store, err := c.openKeys()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	k, err := change(store)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(k)
+	}
+	c.printKeys([]apikey.Key{k})
+	return nil
+}
+
+// newUser has the rules of the API's user bodies
+type newUser struct {
+	Name  string `json:"name" validate:"required,max=100"`
+	Email string `json:"email" validate:"email,max=254"`
+}
+
+func (c *cli) usersCreate(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("users create", flag.ContinueOnError)
+	var u newUser
+	fset.StringVar(&u.Name, "name", "", "user name")
+	fset.StringVar(&u.Email, "email", "", "email address (optional)")
+	tenantID := fset.String("tenant", tenant.Default, "tenant the user belongs to")
+	if _, err := parseFlags(fset, args, 0); err != nil {
+		return err
+	}
+	ctx = tenant.NewContext(ctx, tenant.Scope{ID: *tenantID})
+	if err := validate.Struct(u); err != nil {
+		return err
+	}
+
+	repo, err := c.openUsers()
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	user, err := repo.Create(ctx, repository.User{Name: u.Name, Email: u.Email})
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(user)
+	}
+	fmt.Fprintf(c.out, "created user %d %s <%s> in tenant %s\n", user.ID, user.Name, user.Email, user.Tenant)
+	return nil
+}
+
+func (c *cli) usersDelete(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("users delete", flag.ContinueOnError)
+	tenantID := fset.String("tenant", "", "only delete the user if it belongs to this tenant")
+	pos, err := parseFlags(fset, args, 1)
+	if err != nil {
+		return err
+	}
+	scope := tenant.Scope{ID: *tenantID}
+	if scope.ID == "" {
+		scope = tenant.Scope{ID: tenant.Default, All: true}
+	}
+	ctx = tenant.NewContext(ctx, scope)
+	id, err := strconv.ParseInt(pos[0], 10, 64)
+	if err != nil || id <= 0 {
+		return fmt.Errorf("%w: invalid user id %q", errUsage, pos[0])
+	}
+
+	repo, err := c.openUsers()
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	if err := repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(map[string]any{"deleted": id})
+	}
+	fmt.Fprintf(c.out, "deleted user %d\n", id)
+	return nil
+}
+
+func (c *cli) printJSON(v any) error {
+	enc := json.NewEncoder(c.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printKeys writes keys as a table with their state
+func (c *cli) printKeys(keys []apikey.Key) {
+	tw := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tTENANT\tSCOPES\tSTATE\tEXPIRES\tLAST USED\tCREATED")
+	now := time.Now()
+	for _, k := range keys {
+		state := "active"
+		switch {
+		case !k.RevokedAt.IsZero():
+			state = "revoked"
+		case k.Expired(now):
+			state = "expired"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", k.ID, k.Name, k.Tenant, strings.Join(k.Scopes, ","), state,
+			formatTime(k.ExpiresAt, "never"), formatTime(k.LastUsedAt, "never"), formatTime(k.CreatedAt, "-"))
+	}
+	tw.Flush()
+}
+
+func formatTime(t time.Time, zero string) string {
+	if t.IsZero() {
+		return zero
+	}
+	return t.Local().Format(time.DateTime)
+}
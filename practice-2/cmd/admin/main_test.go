@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"tiny-http/internal/apikey"
+	"tiny-http/internal/repository"
+)
+
+// admin runs the command against fresh databases in dir, ignoring
+// API_KEYS_DB and DB_PATH from the environment
+type admin struct {
+	t              *testing.T
+	keysDB, userDB string
+}
+
+func newAdmin(t *testing.T) *admin {
+	t.Setenv("API_KEYS_DB", "")
+	t.Setenv("DB_PATH", "")
+	dir := t.TempDir()
+	return &admin{t: t, keysDB: filepath.Join(dir, "keys.db"), userDB: filepath.Join(dir, "users.db")}
+}
+
+func (a *admin) run(args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = run(append([]string{"-keys-db", a.keysDB, "-db", a.userDB}, args...), &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+// key runs a keys command with -json and decodes the key it prints
+func (a *admin) key(args ...string) createdKey {
+	a.t.Helper()
+	code, out, errOut := a.run(append([]string{"-json", "keys"}, args...)...)
+	if code != 0 {
+		a.t.Fatalf("keys %v: exit %d: %s", args, code, errOut)
+	}
+	var k createdKey
+	if err := json.Unmarshal([]byte(out), &k); err != nil {
+		a.t.Fatalf("keys %v: %v in %s", args, err, out)
+	}
+	return k
+}
+
+func (a *admin) lookup(secret string) (apikey.Key, error) {
+	a.t.Helper()
+	store, err := apikey.NewSQLiteStore(a.keysDB)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	defer store.Close()
+	return store.Lookup(context.Background(), secret)
+}
+
+func TestKeysLifecycle(t *testing.T) {
+	a := newAdmin(t)
+	created := a.key("create", "-name", "ci", "-id", "ci", "-tenant", "team-a", "-scopes", "users:read, users:write,users:read")
+	if created.ID != "ci" || created.Tenant != "team-a" || !strings.HasPrefix(created.Secret, "tk_") ||
+		!slices.Equal(created.Scopes, []string{apikey.ScopeUsersRead, apikey.ScopeUsersWrite}) {
+		t.Errorf("created = %+v", created)
+	}
+	if k, err := a.lookup(created.Secret); err != nil || k.ID != "ci" {
+		t.Fatalf("the printed secret doesn't authenticate: %v", err)
+	}
+
+	if k := a.key("scopes", "ci", "users:read"); !slices.Equal(k.Scopes, []string{apikey.ScopeUsersRead}) {
+		t.Errorf("after scopes: %v", k.Scopes)
+	}
+	if k := a.key("expire", "ci", "-in", "1h"); time.Until(k.ExpiresAt) < 59*time.Minute {
+		t.Errorf("after expire -in 1h: expires %v", k.ExpiresAt)
+	}
+	if k := a.key("expire", "-never", "ci"); !k.ExpiresAt.IsZero() {
+		t.Errorf("after expire -never: expires %v", k.ExpiresAt)
+	}
+	if k := a.key("expire", "ci"); k.ExpiresAt.IsZero() {
+		t.Error("expire without a time didn't expire the key now")
+	}
+	if k := a.key("revoke", "ci"); k.RevokedAt.IsZero() {
+		t.Error("revoke didn't set revoked_at")
+	}
+	if _, err := a.lookup(created.Secret); err == nil {
+		t.Error("revoked key still authenticates")
+	}
+
+	code, out, _ := a.run("keys", "list")
+	if code != 0 || !strings.Contains(out, "ci") || !strings.Contains(out, "revoked") {
+		t.Errorf("keys list: exit %d\n%s", code, out)
+	}
+}
+
+func TestKeysCreatePrintsSecretOnce(t *testing.T) {
+	a := newAdmin(t)
+	code, out, _ := a.run("keys", "create", "-name", "ci", "-expires", "720h")
+	if code != 0 || !strings.Contains(out, "secret: tk_") {
+		t.Fatalf("keys create: exit %d\n%s", code, out)
+	}
+	if _, out, _ := a.run("-json", "keys", "list"); strings.Contains(out, "tk_") || strings.Contains(out, `"secret"`) {
+		t.Errorf("keys list shows the secret:\n%s", out)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	a := newAdmin(t)
+	code, out, errOut := a.run("-json", "users", "create", "-name", "Alice", "-email", "alice@example.com", "-tenant", "team-a")
+	if code != 0 {
+		t.Fatalf("users create: exit %d: %s", code, errOut)
+	}
+	var u repository.User
+	if err := json.Unmarshal([]byte(out), &u); err != nil || u.ID == 0 || u.Tenant != "team-a" {
+		t.Fatalf("created %s: %v", out, err)
+	}
+
+	if code, _, _ := a.run("users", "create", "-name", "Bob", "-email", "not an email"); code != 1 {
+		t.Errorf("invalid email: exit %d, want 1", code)
+	}
+	userID := strconv.FormatInt(u.ID, 10)
+	if code, _, _ := a.run("users", "delete", userID, "-tenant", "team-b"); code != 1 {
+		t.Errorf("delete from another tenant: exit %d, want 1", code)
+	}
+	if code, out, _ := a.run("users", "delete", userID); code != 0 || !strings.Contains(out, "deleted user") {
+		t.Errorf("delete: exit %d, %s", code, out)
+	}
+	if code, _, _ := a.run("users", "delete", userID); code != 1 {
+		t.Errorf("delete twice: exit %d, want 1", code)
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"no command", nil},
+		{"unknown command", []string{"keys", "rotate"}},
+		{"create without a name", []string{"keys", "create"}},
+		{"unknown scope", []string{"keys", "create", "-name", "ci", "-scopes", "users:admin"}},
+		{"bad expiry", []string{"keys", "create", "-name", "ci", "-expires", "soon"}},
+		{"missing id", []string{"keys", "revoke"}},
+		{"extra argument", []string{"keys", "list", "all"}},
+		{"two expiry flags", []string{"keys", "expire", "ci", "-in", "1h", "-never"}},
+		{"bad user id", []string{"users", "delete", "0"}},
+		{"unknown flag", []string{"keys", "list", "-all"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, errOut := newAdmin(t).run(tt.args...)
+			if code != 2 || !strings.Contains(errOut, "usage:") {
+				t.Errorf("exit %d, want 2 with the usage text; stderr:\n%s", code, errOut)
+			}
+		})
+	}
+}
+
+func TestMissingDatabase(t *testing.T) {
+	t.Setenv("API_KEYS_DB", "")
+	var out, errOut bytes.Buffer
+	if code := run([]string{"keys", "list"}, &out, &errOut); code != 2 || !strings.Contains(errOut.String(), "API_KEYS_DB") {
+		t.Errorf("exit %d, stderr %q; want 2 naming API_KEYS_DB", code, errOut.String())
+	}
+}
+
+func TestUnknownKey(t *testing.T) {
+	code, _, errOut := newAdmin(t).run("keys", "revoke", "nobody")
+	if code != 1 || !strings.Contains(errOut, apikey.ErrNotFound.Error()) {
+		t.Errorf("exit %d, stderr %q; want 1 with not found", code, errOut)
+	}
+}
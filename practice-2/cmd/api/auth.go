@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"tiny-http/internal/apikey"
+	"tiny-http/internal/problem"
+	"tiny-http/internal/tenant"
+	"tiny-http/internal/token"
+)
+
+// POST /auth/login {"api_key":"..."}
+//
+// Exchanges an API key for an access/refresh token pair carrying the key's
+// id, tenant and scopes.
+func (a *api) loginHandler(w http.ResponseWriter, r *http.Request, body loginRequest) error {
+	key, err := a.keys.Lookup(r.Context(), body.APIKey)
+	if errors.Is(err, apikey.ErrUnknownKey) || errors.Is(err, apikey.ErrExpired) {
+		return problem.New(http.StatusUnauthorized, "invalid credentials")
+	}
+	if err != nil {
+		return problem.Internal(err)
+	}
+
+	pair, err := a.tokens.Issue(key.ID, key.Name, tenant.Name(key.Tenant), key.Scopes)
+	if err != nil {
+		return problem.Internal(err)
+	}
+	writeJSON(w, http.StatusOK, pair)
+	return nil
+}
+
+// POST /auth/refresh {"refresh_token":"..."}
+//
+// The key the token was issued for is looked up again, so a revoked or
+// expired key can't be refreshed and the new pair carries the key's current
+// tenant and scopes.
+func (a *api) refreshHandler(w http.ResponseWriter, r *http.Request, body refreshRequest) error {
+	claims, err := a.tokens.Verify(body.RefreshToken, token.TypeRefresh)
+	if errors.Is(err, token.ErrExpired) {
+		return problem.New(http.StatusUnauthorized, "refresh token expired")
+	}
+	if err != nil {
+		return problem.New(http.StatusUnauthorized, "invalid refresh token")
+	}
+
+	key, err := a.keys.LookupID(r.Context(), claims.Subject)
+	if errors.Is(err, apikey.ErrUnknownKey) || errors.Is(err, apikey.ErrExpired) {
+		return problem.New(http.StatusUnauthorized, "api key is no longer valid")
+	}
+	if err != nil {
+		return problem.Internal(err)
+	}
+
+	pair, err := a.tokens.Issue(key.ID, key.Name, tenant.Name(key.Tenant), key.Scopes)
+	if err != nil {
+		return problem.Internal(err)
+	}
+	writeJSON(w, http.StatusOK, pair)
+	return nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"tiny-http/internal/apikey"
+	"tiny-http/internal/grpcauth"
+	"tiny-http/internal/repository"
+	"tiny-http/internal/tracing"
+	"tiny-http/internal/userpb"
+	"tiny-http/internal/validate"
+)
+
+// userService serves users.v1.UserService from the same repository and
+// validation rules as the /users routes
+type userService struct {
+	userpb.UnimplementedUserServiceServer
+	users repository.UserRepository
+}
+
+func (s *userService) GetUser(ctx context.Context, req *userpb.GetUserRequest) (*userpb.User, error) {
+	if err := checkID(req.GetId()); err != nil {
+		return nil, err
+	}
+	user, err := s.users.Get(ctx, req.GetId())
+	if err != nil {
+		return nil, repoStatus(err)
+	}
+	return userMessage(user), nil
+}
+
+func (s *userService) CreateUser(ctx context.Context, req *userpb.CreateUserRequest) (*userpb.User, error) {
+	body := userRequest{Name: req.GetName(), Email: req.GetEmail()}
+	if err := invalidArgument(validate.Struct(body)); err != nil {
+		return nil, err
+	}
+	user, err := s.users.Create(ctx, repository.User{Name: body.Name, Email: body.Email})
+	if err != nil {
+		return nil, repoStatus(err)
+	}
+	return userMessage(user), nil
+}
+
+func (s *userService) ListUsers(ctx context.Context, req *userpb.ListUsersRequest) (*userpb.ListUsersResponse, error) {
+	q := listQuery{Limit: int(req.GetLimit()), Offset: int(req.GetOffset())}
+	if q.Limit == 0 {
+		q.Limit = defaultPageSize
+	}
+	if err := invalidArgument(validate.Struct(q)); err != nil {
+		return nil, err
+	}
+	users, err := s.users.List(ctx, q.Limit, q.Offset)
+	if err != nil {
+		return nil, repoStatus(err)
+	}
+	resp := &userpb.ListUsersResponse{Limit: int32(q.Limit), Offset: int32(q.Offset)}
+	for _, u := range users {
+		resp.Users = append(resp.Users, userMessage(u))
+	}
+	return resp, nil
+}
+
+func (s *userService) DeleteUser(ctx context.Context, req *userpb.DeleteUserRequest) (*userpb.DeleteUserResponse, error) {
+	if err := checkID(req.GetId()); err != nil {
+		return nil, err
+	}
+	if err := s.users.Delete(ctx, req.GetId()); err != nil {
+		return nil, repoStatus(err)
+	}
+	return &userpb.DeleteUserResponse{}, nil
+}
+
+// checkID rejects ids below 1. userPath's min=1 can't: validation skips
+// zero values, and an unset id field is 0 in proto3.
+func checkID(id int64) error {
+	if id > 0 {
+		return nil
+	}
+	return invalidArgument(&validate.Error{Fields: []validate.FieldError{{Field: "id", Rule: "min", Param: "1"}}})
+}
+
+// userMessage converts a repository user to its protobuf form
+func userMessage(u repository.User) *userpb.User {
+	return &userpb.User{
+		Id:        u.ID,
+		Tenant:    u.Tenant,
+		Name:      u.Name,
+		Email:     u.Email,
+		CreatedAt: timestamppb.New(u.CreatedAt),
+	}
+}
+
+// invalidArgument turns a validation error into INVALID_ARGUMENT with the
+// failed rules attached as a BadRequest detail
+func invalidArgument(err error) error {
+	var verr *validate.Error
+	if !errors.As(err, &verr) {
+		return err
+	}
+	br := &errdetails.BadRequest{}
+	for _, f := range verr.Fields {
+		desc := f.Rule
+		if f.Param != "" {
+			desc += "=" + f.Param
+		}
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field: f.Field, Description: desc,
+		})
+	}
+	st, derr := status.New(codes.InvalidArgument, verr.Error()).WithDetails(br)
+	if derr != nil {
+		return status.Error(codes.InvalidArgument, verr.Error())
+	}
+	return st.Err()
+}
+
+// repoStatus maps repository errors to status codes, as repoError does to
+// problems
+func repoStatus(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, repository.ErrConflict):
+		return status.Error(codes.AlreadyExists, err.Error())
+	default:
+		slog.Error("grpc call failed", "err", err)
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+// userScopes are the scopes each UserService method needs, matching the
+// read/write split of the HTTP routes
+var userScopes = map[string]string{
+	userpb.UserService_GetUser_FullMethodName:    apikey.ScopeUsersRead,
+	userpb.UserService_ListUsers_FullMethodName:  apikey.ScopeUsersRead,
+	userpb.UserService_CreateUser_FullMethodName: apikey.ScopeUsersWrite,
+	userpb.UserService_DeleteUser_FullMethodName: apikey.ScopeUsersWrite,
+}
+
+// observeCalls is the outermost unary interceptor: it continues a trace
+// from traceparent metadata, logs each call with its status code and turns
+// a panic into INTERNAL instead of taking the process down
+func observeCalls(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		start := time.Now()
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if v := md.Get(tracing.TraceparentHeader); len(v) > 0 {
+				if sc, ok := tracing.ParseTraceparent(v[0]); ok {
+					ctx = tracing.ContextWithRemote(ctx, sc)
+				}
+			}
+		}
+		ctx, span := tracing.Start(ctx, info.FullMethod, tracing.KindServer)
+		span.SetAttr("rpc.system", "grpc")
+		span.SetAttr("rpc.method", info.FullMethod)
+
+		defer func() {
+			if p := recover(); p != nil {
+				logger.ErrorContext(ctx, "grpc panic",
+					"method", info.FullMethod,
+					"trace_id", tracing.TraceIDFromContext(ctx),
+					"panic", fmt.Sprint(p),
+					"stack", string(debug.Stack()),
+				)
+				resp, err = nil, status.Error(codes.Internal, "internal error")
+			}
+
+			code := status.Code(err)
+			span.SetAttr("rpc.grpc.status_code", int(code))
+			if code != codes.OK {
+				span.SetStatus(tracing.StatusError, code.String())
+			}
+			span.End()
+
+			level := slog.LevelInfo
+			switch code {
+			case codes.OK:
+			case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable:
+				level = slog.LevelError
+			default:
+				level = slog.LevelWarn
+			}
+			attrs := []slog.Attr{
+				slog.String("method", info.FullMethod),
+				slog.String("code", code.String()),
+				slog.Duration("duration", time.Since(start)),
+			}
+			if id := tracing.TraceIDFromContext(ctx); id != "" {
+				attrs = append(attrs, slog.String("trace_id", id))
+			}
+			logger.LogAttrs(ctx, level, "grpc call", attrs...)
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// newGRPCServer builds the gRPC server with the user service, health
+// checking and reflection. The health server starts out SERVING; set it to
+// NOT_SERVING when draining. tlsState's config is reused when TLS is on.
+func newGRPCServer(logger *slog.Logger, users repository.UserRepository, keys apikey.Store, tlsState tlsSetup) (*grpc.Server, *health.Server) {
+	auth := grpcauth.New(keys, grpcauth.Policy{
+		Scopes: userScopes,
+		Public: []string{healthpb.Health_ServiceDesc.ServiceName, "grpc.reflection.v1.ServerReflection",
+			"grpc.reflection.v1alpha.ServerReflection"},
+	})
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(observeCalls(logger), auth.Unary()),
+		grpc.ChainStreamInterceptor(auth.Stream()),
+	}
+	if tlsState.config != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsState.config)))
+	}
+	srv := grpc.NewServer(opts...)
+
+	userpb.RegisterUserServiceServer(srv, &userService{users: users})
+	probe := health.NewServer()
+	probe.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	probe.SetServingStatus(userpb.UserService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(srv, probe)
+	reflection.Register(srv)
+	return srv, probe
+}
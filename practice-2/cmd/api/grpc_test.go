@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"tiny-http/internal/middleware"
+	"tiny-http/internal/repository"
+	"tiny-http/internal/userpb"
+)
+
+// Every UserService method needs a scope, or grpcauth refuses it for all
+// keys; this catches a method added to the proto without one
+func TestUserScopesCoverService(t *testing.T) {
+	for _, m := range userpb.UserService_ServiceDesc.Methods {
+		name := "/" + userpb.UserService_ServiceDesc.ServiceName + "/" + m.MethodName
+		if _, ok := userScopes[name]; !ok {
+			t.Errorf("%s has no scope", name)
+		}
+	}
+	if len(userScopes) != len(userpb.UserService_ServiceDesc.Methods) {
+		t.Errorf("userScopes has %d methods, the service %d", len(userScopes), len(userpb.UserService_ServiceDesc.Methods))
+	}
+}
+
+func TestUserServiceRejectsBadIDs(t *testing.T) {
+	s := &userService{users: repository.NewMemoryUserRepository()}
+	for _, id := range []int64{0, -1} {
+		_, err := s.GetUser(context.Background(), &userpb.GetUserRequest{Id: id})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("GetUser(%d): code = %v, want InvalidArgument", id, status.Code(err))
+		}
+		_, err = s.DeleteUser(context.Background(), &userpb.DeleteUserRequest{Id: id})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("DeleteUser(%d): code = %v, want InvalidArgument", id, status.Code(err))
+		}
+	}
+
+	_, err := s.GetUser(context.Background(), &userpb.GetUserRequest{})
+	var br *errdetails.BadRequest
+	for _, d := range status.Convert(err).Details() {
+		if d, ok := d.(*errdetails.BadRequest); ok {
+			br = d
+		}
+	}
+	if br == nil || len(br.FieldViolations) != 1 || br.FieldViolations[0].Field != "id" {
+		t.Errorf("details = %v, want a BadRequest for id", status.Convert(err).Details())
+	}
+
+	ctx := middleware.ContextWithIdentity(context.Background(), middleware.Identity{ID: "reader", Tenant: "team-a"})
+	if _, err := s.GetUser(ctx, &userpb.GetUserRequest{Id: 42}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetUser(42): code = %v, want NotFound", status.Code(err))
+	}
+}
@@ -1,72 +1,516 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
-	"strconv"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
 
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+
+	"tiny-http/internal/apikey"
+	"tiny-http/internal/certs"
+	"tiny-http/internal/config"
+	"tiny-http/internal/health"
+	"tiny-http/internal/hmacauth"
+	"tiny-http/internal/idempotency"
+	"tiny-http/internal/lockout"
+	"tiny-http/internal/metrics"
 	"tiny-http/internal/middleware"
+	"tiny-http/internal/openapi"
+	"tiny-http/internal/problem"
+	"tiny-http/internal/ratelimit"
+	"tiny-http/internal/redis"
+	"tiny-http/internal/repository"
+	"tiny-http/internal/token"
+	"tiny-http/internal/tracing"
+	"tiny-http/internal/validate"
 )
 
-// JSONError helper for consistent API errors
-func JSONError(w http.ResponseWriter, status int, msg string) {
+// decodeBody decodes and validates the JSON request body into dst
+func decodeBody(r *http.Request, dst any) error {
+	return invalid(validate.DecodeJSON(r, dst))
+}
+
+// invalid converts validation and decoding errors into 400 problems, or
+// 413 for oversized bodies
+func invalid(err error) error {
+	var verr *validate.Error
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &verr):
+		return problem.Validation(verr.Fields)
+	case errors.Is(err, validate.ErrTooLarge):
+		return problem.New(http.StatusRequestEntityTooLarge, err.Error())
+	default:
+		return problem.BadRequest("%s", err)
+	}
+}
+
+// writeJSON writes v as a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+	json.NewEncoder(w).Encode(v)
 }
 
-// GET /user?id=123
-func getUserHandler(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Query().Get("id")
-	id, err := strconv.Atoi(idStr)
-	if err != nil || id <= 0 {
-		JSONError(w, http.StatusBadRequest, "invalid id")
-		return
+// api holds the dependencies shared by the handlers
+type api struct {
+	users  repository.UserRepository
+	keys   apikey.Store
+	tokens *token.Manager
+}
+
+// loadKeys builds the API key store from a JSON key file, a SQLite database
+// or, as a fallback, the single key in API_KEY
+func loadKeys(cfg *config.Config) (apikey.Store, error) {
+	switch {
+	case cfg.KeysFile != "":
+		return apikey.LoadFile(cfg.KeysFile)
+	case cfg.KeysDB != "":
+		return apikey.NewSQLiteStore(cfg.KeysDB)
 	}
+	return apikey.NewMemoryStore(apikey.Key{
+		ID:     "env",
+		Name:   "API_KEY",
+		Hash:   apikey.HashSecret(cfg.APIKey),
+		Scopes: []string{apikey.ScopeUsersRead, apikey.ScopeUsersWrite},
+	}), nil
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]int{"user_id": id})
+// loadTokens builds the JWT manager. It returns nil when no JWT_SECRET is
+// set, which disables bearer authentication.
+func loadTokens(cfg *config.Config) *token.Manager {
+	if cfg.JWTSecret == "" {
+		return nil
+	}
+	return token.NewManager(cfg.JWTSecret, "tiny-http", cfg.JWTExpiry, cfg.JWTRefreshExpiry)
+}
+
+// loadSignatures builds the request signature verifier, or returns nil when
+// no SIGNING_KEYS_FILE is set
+func loadSignatures(cfg *config.Config) (*hmacauth.Verifier, error) {
+	if cfg.SigningKeysFile == "" {
+		return nil, nil
+	}
+	keys, err := hmacauth.LoadFile(cfg.SigningKeysFile)
+	if err != nil {
+		return nil, err
+	}
+	return hmacauth.NewVerifier(keys, hmacauth.NewMemoryNonces(), cfg.SigningSkew), nil
 }
 
-// POST /user {"name":"Alice"}
-func postUserHandler(w http.ResponseWriter, r *http.Request) {
-	var body struct {
-		Name string `json:"name"`
+// newTracer returns the tracer for TRACE_EXPORTER, or nil when tracing is off
+func newTracer(cfg *config.Config) (*tracing.Tracer, error) {
+	var exp tracing.Exporter
+	switch cfg.Tracing.Exporter {
+	case config.TraceStdout:
+		exp = tracing.NewWriterExporter(os.Stdout)
+	case config.TraceFile:
+		f, err := tracing.NewFileExporter(cfg.Tracing.File)
+		if err != nil {
+			return nil, err
+		}
+		exp = f
+	case config.TraceOTLP:
+		exp = tracing.NewOTLPExporter(cfg.Tracing.OTLPEndpoint, cfg.Tracing.ServiceName)
+	default:
+		return nil, nil
 	}
+	return tracing.NewTracer(exp), nil
+}
 
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		JSONError(w, http.StatusBadRequest, "invalid name")
-		return
+// newLimiter returns the rate limiter backend selected by RATE_LIMIT_BACKEND
+func newLimiter(cfg *config.Config) (ratelimit.Limiter, error) {
+	if cfg.RateLimit.Backend != "redis" {
+		return ratelimit.NewMemory(), nil
+	}
+	client, err := redis.New(cfg.RedisURL)
+	if err != nil {
+		return nil, err
 	}
-	if body.Name == "" {
-		JSONError(w, http.StatusBadRequest, "invalid name")
-		return
+	return ratelimit.NewRedis(client), nil
+}
+
+// tlsReloadInterval is how often certificate files are checked for changes
+const tlsReloadInterval = 30 * time.Second
+
+// tlsSetup is the server's TLS state; the zero value means plain HTTP
+type tlsSetup struct {
+	config   *tls.Config
+	reloader *certs.Reloader
+	clients  *certs.ClientMap
+}
+
+// loadTLS loads the certificate (or generates one in self-signed mode) and,
+// for mTLS, the client CA and the client identity map
+func loadTLS(cfg *config.Config) (tlsSetup, error) {
+	var s tlsSetup
+	if !cfg.TLS.Enabled() {
+		return s, nil
 	}
+	s.config = &tls.Config{MinVersion: tls.VersionTLS12}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"created": body.Name})
+	if cfg.TLS.SelfSigned {
+		cert, err := certs.SelfSigned("localhost", "127.0.0.1", "::1", cfg.Host)
+		if err != nil {
+			return s, fmt.Errorf("self-signed certificate: %w", err)
+		}
+		s.config.Certificates = []tls.Certificate{cert}
+	} else {
+		r, err := certs.NewReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return s, err
+		}
+		s.reloader = r
+		s.config.GetCertificate = r.GetCertificate
+	}
+
+	if cfg.TLS.ClientCA != "" {
+		pool, err := certs.LoadCAPool(cfg.TLS.ClientCA)
+		if err != nil {
+			return s, err
+		}
+		clients, err := certs.LoadClientMap(cfg.TLS.ClientMap)
+		if err != nil {
+			return s, err
+		}
+		// Certificates are optional so API keys and tokens keep working
+		s.config.ClientCAs = pool
+		s.config.ClientAuth = tls.VerifyClientCertIfGiven
+		s.clients = clients
+	}
+	return s, nil
+}
+
+// minFreeDisk is the free space below which the data directory fails
+// readiness
+const minFreeDisk = 64 << 20
+
+// closer is a dependency to release after the server has stopped
+type closer struct {
+	name string
+	io.Closer
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "openapi" {
+		os.Exit(openapiCommand(os.Args[2:]))
+	}
+	if err := run(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	cfg, err := config.Load(args)
+	if err != nil {
+		return err
+	}
+
+	// JSON logs everywhere but development, where text is easier to read
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(cfg.LogLevel)
+	logOpts := &slog.HandlerOptions{Level: logLevel}
+	var logHandler slog.Handler = slog.NewJSONHandler(os.Stderr, logOpts)
+	if cfg.Env == config.EnvDevelopment {
+		logHandler = slog.NewTextHandler(os.Stderr, logOpts)
+	}
+	logger := slog.New(logHandler)
+	slog.SetDefault(logger)
+
+	// Only the log level is safe to change without a restart
+	stopReload := config.WatchReload(args, func(next *config.Config) {
+		logLevel.Set(next.LogLevel)
+		logger.Info("configuration reloaded", "log_level", next.LogLevel)
+	})
+	defer stopReload()
+
+	// Dependencies are closed in reverse order once the server has drained
+	var closers []closer
+	defer func() {
+		for i := len(closers) - 1; i >= 0; i-- {
+			c := closers[i]
+			logger.Info("closing " + c.name)
+			if err := c.Close(); err != nil {
+				logger.Error("close "+c.name, "err", err)
+			}
+		}
+	}()
+	track := func(name string, v any) {
+		if c, ok := v.(io.Closer); ok {
+			closers = append(closers, closer{name, c})
+		}
+	}
+
+	// The tracer is tracked first so it is closed last, after the spans of
+	// the final requests have ended
+	tracer, err := newTracer(cfg)
+	if err != nil {
+		return err
+	}
+	if tracer != nil {
+		tracing.SetDefault(tracer)
+		track("tracer", tracer)
+	}
+
+	var users repository.UserRepository
+	dbSystem := "memory"
+	if cfg.DB.Path != "" {
+		repo, err := repository.NewSQLiteUserRepository(cfg.DB.Path)
+		if err != nil {
+			return err
+		}
+		users = repo
+		dbSystem = "sqlite"
+	} else {
+		users = repository.NewMemoryUserRepository()
+	}
+	track("user repository", users)
+
+	keys, err := loadKeys(cfg)
+	if err != nil {
+		return err
+	}
+	track("api key store", keys)
+
+	limiter, err := newLimiter(cfg)
+	if err != nil {
+		return err
+	}
+	track("rate limiter", limiter)
+
+	tokens := loadTokens(cfg)
+
+	tlsState, err := loadTLS(cfg)
+	if err != nil {
+		return err
+	}
+
+	signatures, err := loadSignatures(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Readiness pings whichever dependencies support it
+	probes := health.New(2*time.Second, time.Second)
+	for name, dep := range map[string]any{"database": users, "api_keys": keys, "redis": limiter} {
+		if p, ok := dep.(health.Pinger); ok {
+			probes.Add(name, p.Ping)
+		}
+	}
+	dataDir := "."
+	if cfg.DB.Path != "" {
+		dataDir = filepath.Dir(cfg.DB.Path)
+	}
+	probes.Add("disk", health.DiskSpace(dataDir, minFreeDisk))
+
+	a := &api{users: repository.NewTracedUserRepository(users, dbSystem), keys: keys, tokens: tokens}
+	if tokens == nil {
+		logger.Warn("JWT_SECRET not set, bearer authentication disabled")
+	}
+
+	// Middleware order is decided here and nowhere else. Outermost first:
+	//
+	//	global:    RequestID, Tracing, AccessLog, CORS, Metrics, Recover, Compress, then the mux
+	//	protected: lockout, auth, rate limit, Idempotency-Key, then the handler
+	//	token:     lockout, rate limit, then the handler
+	//
+	// Tracing runs before AccessLog so access log lines carry the trace id.
+	// Tracing and Metrics read the matched route pattern after the mux
+	// returns, so nothing between them and the mux may replace the request.
+	// CORS answers preflights before any auth runs. Metrics sits outside
+	// Recover so the 500 written for a panic in any group is counted, and
+	// outside Compress so it and the access log record the bytes actually
+	// sent. Recover sits outside Compress so a panic after the handler wrote
+	// into Compress's buffer, but before anything was sent, still gets a 500
+	// instead of an aborted connection. Compress decompresses request bodies before auth, so idempotency
+	// fingerprints see the decoded body; signatures are checked against the
+	// compressed body Compress keeps for them. Rate limits and idempotency
+	// keys run inside auth so they can key on the caller; lockout runs
+	// outside it to count its 401s and turn away locked out clients before
+	// their keys are checked.
+	global := middleware.NewChain(middleware.RequestID, middleware.Tracing, middleware.AccessLog(logger))
+	if len(cfg.CORS.Origins) > 0 {
+		global = global.Use(middleware.CORS(middleware.CORSOptions(cfg.CORS)))
+	}
+	global = global.Use(middleware.Metrics, middleware.Recover(logger),
+		middleware.Compress(middleware.CompressOptions(cfg.Compression)))
+
+	// Auth failures on any route count towards the same lockout
+	lock := middleware.Lockout(lockout.NewTracker(cfg.Lockout.Policy), cfg.Lockout.Trusted,
+		logger.With("log", "audit"))
+
 	mux := http.NewServeMux()
+	public := middleware.NewGroup(mux)
+	groups := map[access]*middleware.Group{
+		accessUsers: public.Group(
+			lock,
+			middleware.AuthMiddleware(middleware.Authenticators{
+				Keys:       keys,
+				Tokens:     tokens,
+				Clients:    tlsState.clients,
+				Signatures: signatures,
+			}, "users"),
+			middleware.RateLimit(limiter, "users", cfg.RateLimit.Users),
+			middleware.Idempotency(idempotency.NewMemory(cfg.IdempotencyMaxBytes), cfg.IdempotencyTTL),
+		),
+		accessToken: public.Group(lock, middleware.RateLimit(limiter, "auth", cfg.RateLimit.Auth)),
+	}
 
-	// Protect both routes with middleware
-	mux.Handle("/user", middleware.APIKeyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodGet:
-			getUserHandler(w, r)
-		case http.MethodPost:
-			postUserHandler(w, r)
-		default:
-			JSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	var routes []route
+	for _, rt := range a.routes() {
+		if rt.access == accessToken && tokens == nil {
+			continue
 		}
-	})))
+		routes = append(routes, rt)
+	}
+	register(public, groups, routes)
 
-	fmt.Println("Server running on :8080")
-	log.Fatal(http.ListenAndServe(":8080", mux))
-}
+	public.Handle("GET /healthz", probes.LiveHandler())
+	public.Handle("GET /readyz", probes.ReadyHandler())
+	public.Handle("GET /openapi.json", apiSpec().Handler())
+	public.Handle("GET /docs", openapi.DocsHandler("/openapi.json"))
+	// Metrics go on their own listener when METRICS_ADDR is set so they can
+	// be kept off the public port
+	var metricsSrv *http.Server
+	if cfg.MetricsAddr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("GET /metrics", metrics.Default.Handler())
+		metricsSrv = &http.Server{
+			Addr:              cfg.MetricsAddr,
+			Handler:           metricsMux,
+			ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+			ErrorLog:          slog.NewLogLogger(logHandler, slog.LevelWarn),
+		}
+	} else {
+		public.Handle("GET /metrics", metrics.Default.Handler())
+	}
+	public.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, http.StatusNotFound, "no route for "+r.URL.Path)
+	})
+
+	srv := &http.Server{
+		Addr:              cfg.Addr(),
+		Handler:           global.Then(mux),
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+		TLSConfig:         tlsState.config,
+		ErrorLog:          slog.NewLogLogger(logHandler, slog.LevelWarn),
+	}
+
+	// The gRPC user service shares the repository and key store but has its
+	// own port and interceptors
+	var (
+		grpcSrv    *grpc.Server
+		grpcProbe  *grpchealth.Server
+		grpcListen net.Listener
+	)
+	if cfg.GRPCPort != 0 {
+		grpcListen, err = net.Listen("tcp", cfg.GRPCAddr())
+		if err != nil {
+			return err
+		}
+		grpcSrv, grpcProbe = newGRPCServer(logger, a.users, keys, tlsState)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 3)
+	go func() {
+		if srv.TLSConfig == nil {
+			logger.Info("server listening", "addr", srv.Addr, "env", cfg.Env, "tls", false)
+			serveErr <- srv.ListenAndServe()
+			return
+		}
+		logger.Info("server listening", "addr", srv.Addr, "env", cfg.Env, "tls", true,
+			"self_signed", cfg.TLS.SelfSigned, "mtls", tlsState.clients != nil)
+		serveErr <- srv.ListenAndServeTLS("", "")
+	}()
+	if tlsState.reloader != nil {
+		go tlsState.reloader.Watch(ctx, tlsReloadInterval)
+	}
+	if grpcSrv != nil {
+		go func() {
+			logger.Info("grpc listening", "addr", grpcListen.Addr().String(), "tls", tlsState.config != nil)
+			serveErr <- grpcSrv.Serve(grpcListen)
+		}()
+		defer grpcSrv.Stop()
+	}
+	if metricsSrv != nil {
+		go func() {
+			logger.Info("metrics listening", "addr", metricsSrv.Addr)
+			serveErr <- metricsSrv.ListenAndServe()
+		}()
+		defer metricsSrv.Close()
+	}
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	// a second signal kills the process immediately
+	stop()
 
+	// Fail readiness first so load balancers stop sending traffic while the
+	// listener is still open
+	probes.Drain()
+	if grpcProbe != nil {
+		grpcProbe.Shutdown()
+	}
+	if cfg.Server.ShutdownDelay > 0 {
+		logger.Info("readiness failing, waiting before closing the listener", "delay", cfg.Server.ShutdownDelay)
+		time.Sleep(cfg.Server.ShutdownDelay)
+	}
+
+	logger.Info("shutting down, draining in-flight requests", "timeout", cfg.Server.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if grpcSrv != nil {
+		// GracefulStop waits for running calls; Stop cuts them off if the
+		// deadline passes first
+		stopped := make(chan struct{})
+		go func() {
+			grpcSrv.GracefulStop()
+			close(stopped)
+		}()
+		defer func() {
+			select {
+			case <-stopped:
+				logger.Info("grpc server stopped")
+			case <-shutdownCtx.Done():
+				logger.Error("grpc drain deadline exceeded, closing remaining streams")
+				grpcSrv.Stop()
+			}
+		}()
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error("drain deadline exceeded, closing remaining connections", "err", err)
+		srv.Close()
+	} else {
+		logger.Info("server stopped")
+	}
+	return nil
+}
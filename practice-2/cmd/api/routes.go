@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"slices"
+
+	"tiny-http/internal/middleware"
+	"tiny-http/internal/openapi"
+	"tiny-http/internal/problem"
+	"tiny-http/internal/repository"
+	"tiny-http/internal/token"
+)
+
+// access selects the middleware group a route is registered in
+type access int
+
+const (
+	// accessToken routes issue tokens; they are rate limited per client IP
+	// and only exist when JWT_SECRET is set
+	accessToken access = iota
+	// accessUsers routes need an API key or JWT with a users scope and are
+	// rate limited per caller
+	accessUsers
+)
+
+// route is one endpoint: its handler, how it is protected and its OpenAPI
+// description. The mux and the spec are both built from routes() so they
+// can't disagree.
+type route struct {
+	openapi.Endpoint
+	handler routeHandler
+	access  access
+}
+
+// routeHandler is a handler and the request body it decodes, which the spec
+// documents; Endpoint.Request is never set by hand
+type routeHandler struct {
+	serve       problem.HandlerFunc
+	request     any
+	requestType string
+}
+
+// noBody is a handler that reads no request body
+func noBody(fn problem.HandlerFunc) routeHandler {
+	return routeHandler{serve: fn}
+}
+
+// withBody decodes and validates the JSON body as T before calling fn, and
+// documents T as the request body
+func withBody[T any](fn func(http.ResponseWriter, *http.Request, T) error) routeHandler {
+	var zero T
+	return routeHandler{
+		request: zero,
+		serve: func(w http.ResponseWriter, r *http.Request) error {
+			var body T
+			if err := decodeBody(r, &body); err != nil {
+				return err
+			}
+			return fn(w, r, body)
+		},
+	}
+}
+
+// withMergePatch answers anything but a JSON Merge Patch (RFC 7396) with 415
+// and calls fn with the decoded patch. A patch has no fixed shape, so T
+// documents its members.
+func withMergePatch[T any](fn func(http.ResponseWriter, *http.Request, any) error) routeHandler {
+	var zero T
+	return routeHandler{
+		request:     zero,
+		requestType: "application/merge-patch+json",
+		serve: func(w http.ResponseWriter, r *http.Request) error {
+			if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct != "application/merge-patch+json" && ct != "application/json" {
+				w.Header().Set("Accept-Patch", "application/merge-patch+json")
+				return problem.New(http.StatusUnsupportedMediaType, "use application/merge-patch+json")
+			}
+			var patch any
+			if err := decodeBody(r, &patch); err != nil {
+				return err
+			}
+			return fn(w, r, patch)
+		},
+	}
+}
+
+// Request and response bodies that have no other use than documentation
+// still get named types so the spec can reference them.
+type (
+	loginRequest struct {
+		APIKey string `json:"api_key" validate:"required"`
+	}
+	refreshRequest struct {
+		RefreshToken string `json:"refresh_token" validate:"required"`
+	}
+	userList struct {
+		Users  []repository.User `json:"users"`
+		Limit  int               `json:"limit"`
+		Offset int               `json:"offset"`
+	}
+	// userPatch documents PATCH bodies: userRequest's members, all optional
+	userPatch struct {
+		Name  string `json:"name" validate:"max=100"`
+		Email string `json:"email" validate:"email,max=254"`
+	}
+	userPath struct {
+		ID int64 `path:"id" validate:"min=1"`
+	}
+)
+
+// routes lists every API endpoint. It only takes method values of a, so it
+// can be called on a nil *api to build the spec.
+func (a *api) routes() []route {
+	authErrors := []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusRequestEntityTooLarge, http.StatusTooManyRequests}
+	userErrors := []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests}
+	with := func(codes ...int) []int { return append(slices.Clone(userErrors), codes...) }
+
+	return []route{
+		{access: accessToken, handler: withBody(a.loginHandler), Endpoint: openapi.Endpoint{
+			Method: http.MethodPost, Path: "/auth/login", Tag: "auth",
+			Summary:     "Exchange an API key for tokens",
+			Description: "Issues an access token and a refresh token carrying the key's id, tenant and scopes.",
+			Response:    token.Pair{}, Errors: authErrors,
+		}},
+		{access: accessToken, handler: withBody(a.refreshHandler), Endpoint: openapi.Endpoint{
+			Method: http.MethodPost, Path: "/auth/refresh", Tag: "auth",
+			Summary: "Trade a refresh token for a new token pair",
+			Description: "The API key the token was issued for is checked again, so refreshing fails once the key is revoked or expired, " +
+				"and the new pair carries the key's current tenant and scopes.",
+			Response: token.Pair{}, Errors: authErrors,
+		}},
+		{access: accessUsers, handler: noBody(a.listUsersHandler), Endpoint: openapi.Endpoint{
+			Method: http.MethodGet, Path: "/users", Tag: "users",
+			Summary: "List users", Query: listQuery{},
+			Response: userList{}, Errors: with(http.StatusBadRequest),
+		}},
+		{access: accessUsers, handler: withBody(a.createUserHandler), Endpoint: openapi.Endpoint{
+			Method: http.MethodPost, Path: "/users", Tag: "users",
+			Summary: "Create a user",
+			Description: "The Location header points at the new user. Send an Idempotency-Key header to make " +
+				"retries safe: a repeat gets the first response back, a different body under the same key " +
+				"gets 422 and a repeat while the first is still running gets 409.",
+			Response: repository.User{}, Status: http.StatusCreated,
+			Errors: with(http.StatusBadRequest, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity),
+		}},
+		{access: accessUsers, handler: noBody(a.getUserByIDHandler), Endpoint: openapi.Endpoint{
+			Method: http.MethodGet, Path: "/users/{id}", Tag: "users",
+			Summary: "Get a user", Params: userPath{},
+			Response: repository.User{}, Errors: with(http.StatusBadRequest, http.StatusNotFound),
+		}},
+		{access: accessUsers, handler: withBody(a.replaceUserHandler), Endpoint: openapi.Endpoint{
+			Method: http.MethodPut, Path: "/users/{id}", Tag: "users",
+			Summary: "Replace a user", Params: userPath{}, Response: repository.User{},
+			Errors: with(http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusRequestEntityTooLarge),
+		}},
+		{access: accessUsers, handler: withMergePatch[userPatch](a.patchUserHandler), Endpoint: openapi.Endpoint{
+			Method: http.MethodPatch, Path: "/users/{id}", Tag: "users",
+			Summary:     "Update a user with a JSON Merge Patch",
+			Description: "Members set to null are cleared. The patched user must still pass validation.",
+			Params:      userPath{}, Response: repository.User{},
+			Errors: with(http.StatusBadRequest, http.StatusNotFound, http.StatusConflict,
+				http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType),
+		}},
+		{access: accessUsers, handler: noBody(a.deleteUserHandler), Endpoint: openapi.Endpoint{
+			Method: http.MethodDelete, Path: "/users/{id}", Tag: "users",
+			Summary: "Delete a user", Params: userPath{}, Status: http.StatusNoContent,
+			Errors: with(http.StatusBadRequest, http.StatusNotFound),
+		}},
+		{access: accessUsers, handler: noBody(a.getUserHandler), Endpoint: openapi.Endpoint{
+			Method: http.MethodGet, Path: "/user", Tag: "users", Deprecated: true,
+			Summary: "Get a user by query parameter; use GET /users/{id}", Query: legacyQuery{},
+			Response: repository.User{}, Errors: with(http.StatusBadRequest, http.StatusNotFound),
+		}},
+		{access: accessUsers, handler: withBody(a.createUserHandler), Endpoint: openapi.Endpoint{
+			Method: http.MethodPost, Path: "/user", Tag: "users", Deprecated: true,
+			Summary:     "Create a user; use POST /users",
+			Description: "Honours Idempotency-Key like POST /users.",
+			Response:    repository.User{}, Status: http.StatusCreated,
+			Errors: with(http.StatusBadRequest, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity),
+		}},
+	}
+}
+
+// register adds each route to the group for its access level, adding the
+// deprecation headers to deprecated ones, and answers other methods on the
+// same paths from root with a 405 listing the allowed ones
+func register(root *middleware.Group, groups map[access]*middleware.Group, routes []route) {
+	var paths []string
+	allowed := map[string][]string{}
+	for _, rt := range routes {
+		g := groups[rt.access]
+		if rt.Deprecated {
+			g = g.Group(deprecated)
+		}
+		g.Handle(rt.Method+" "+rt.Path, rt.handler.serve)
+		if _, ok := allowed[rt.Path]; !ok {
+			paths = append(paths, rt.Path)
+		}
+		allowed[rt.Path] = append(allowed[rt.Path], rt.Method)
+	}
+	for _, p := range paths {
+		root.Handle(p, methodNotAllowed(allowed[p]...))
+	}
+}
+
+// apiSpec builds the OpenAPI document for every route
+func apiSpec() *openapi.Document {
+	doc := openapi.New("tiny-http", "1.0.0",
+		"User API. Authenticate with an X-API-Key header, a bearer token from /auth/login "+
+			"or, where the server enables them, a request signature or a client certificate. "+
+			"Safe methods need the users:read scope, all others users:write. Callers only see the "+
+			"users of their credential's tenant; other tenants' users are 404. Credentials with the "+
+			"tenants:admin scope see every tenant and may send X-Tenant-ID to act for one, e.g. to "+
+			"create users in it.")
+	doc.SetErrorType(problem.Problem{})
+	doc.Components.SecuritySchemes["ApiKeyAuth"] = openapi.SecurityScheme{
+		Type: "apiKey", In: "header", Name: "X-API-Key",
+	}
+	doc.Components.SecuritySchemes["BearerAuth"] = openapi.SecurityScheme{
+		Type: "http", Scheme: "bearer", BearerFormat: "JWT",
+	}
+	doc.Components.SecuritySchemes["RequestSignature"] = openapi.SecurityScheme{
+		Type: "apiKey", In: "header", Name: "X-Signature",
+		Description: "HMAC-SHA256 request signature with X-Signature-Key-Id, X-Signature-Timestamp and " +
+			"X-Signature-Nonce; see the signing package. Only when the server runs with SIGNING_KEYS_FILE.",
+	}
+	doc.Components.SecuritySchemes["MutualTLS"] = openapi.SecurityScheme{
+		Type:        "mutualTLS",
+		Description: "Client certificate mapped to an identity; only when the server runs with TLS_CLIENT_CA.",
+	}
+
+	for _, rt := range (*api)(nil).routes() {
+		rt.Request, rt.RequestType = rt.handler.request, rt.handler.requestType
+		if rt.access == accessUsers {
+			rt.Security = []string{"ApiKeyAuth", "BearerAuth", "RequestSignature", "MutualTLS"}
+		}
+		doc.Add(rt.Endpoint)
+	}
+	return doc
+}
+
+// specJSON is the spec as api/openapi.json holds it
+func specJSON() ([]byte, error) {
+	b, err := json.MarshalIndent(apiSpec(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// openapiCommand implements "api openapi [-check] [file]": it writes the
+// spec to file, or with -check fails if file differs from what the code
+// describes, e.g. after a request type changed without regenerating.
+func openapiCommand(args []string) int {
+	fset := flag.NewFlagSet("openapi", flag.ContinueOnError)
+	check := fset.Bool("check", false, "fail if the file is out of date instead of writing it")
+	if err := fset.Parse(args); err != nil {
+		return 2
+	}
+	path := "api/openapi.json"
+	if fset.NArg() > 0 {
+		path = fset.Arg(0)
+	}
+
+	want, err := specJSON()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if !*check {
+		if err := os.WriteFile(path, want, 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if !bytes.Equal(got, want) {
+		fmt.Fprintf(os.Stderr, "%s is out of date with the handlers; run: go run ./cmd/api openapi %s\n", path, path)
+		return 1
+	}
+	fmt.Printf("%s is up to date\n", path)
+	return 0
+}
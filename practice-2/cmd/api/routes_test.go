@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestSpecUpToDate is "api openapi -check" run by go test, so a handler
+// that changes what it decodes fails CI until the spec is regenerated
+func TestSpecUpToDate(t *testing.T) {
+	want, err := specJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile("../../api/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("api/openapi.json is out of date with the handlers; run: go run ./cmd/api openapi")
+	}
+}
+
+func TestWithBody(t *testing.T) {
+	var got userRequest
+	h := withBody(func(w http.ResponseWriter, r *http.Request, body userRequest) error {
+		got = body
+		return nil
+	})
+	if _, ok := h.request.(userRequest); !ok {
+		t.Errorf("documented request = %T, want userRequest", h.request)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name":"Alice","email":"alice@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.serve.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || got.Name != "Alice" {
+		t.Errorf("valid body: status %d, decoded %+v", rec.Code, got)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"email":"alice@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	h.serve.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("body without a name: status %d, want 400", rec.Code)
+	}
+}
+
+func TestWithMergePatch(t *testing.T) {
+	h := withMergePatch[userPatch](func(w http.ResponseWriter, r *http.Request, patch any) error {
+		return nil
+	})
+	if _, ok := h.request.(userPatch); !ok || h.requestType != "application/merge-patch+json" {
+		t.Errorf("documented request = %T as %q", h.request, h.requestType)
+	}
+
+	req := httptest.NewRequest(http.MethodPatch, "/users/1", strings.NewReader(`name=Alice`))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	h.serve.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnsupportedMediaType || rec.Header().Get("Accept-Patch") == "" {
+		t.Errorf("form body: status %d, Accept-Patch %q; want 415 with Accept-Patch", rec.Code, rec.Header().Get("Accept-Patch"))
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"tiny-http/internal/problem"
+	"tiny-http/internal/repository"
+	"tiny-http/internal/validate"
+)
+
+const defaultPageSize = 50
+
+// userRequest is the body of POST /users and PUT /users/{id}, and the
+// result of applying a PATCH
+type userRequest struct {
+	Name  string `json:"name" validate:"required,max=100"`
+	Email string `json:"email" validate:"email,max=254"`
+}
+
+// listQuery holds the GET /users query parameters
+type listQuery struct {
+	Limit  int `query:"limit" validate:"min=1,max=200"`
+	Offset int `query:"offset" validate:"min=0"`
+}
+
+// legacyQuery holds the GET /user query parameters
+type legacyQuery struct {
+	ID int64 `query:"id" validate:"required,min=1"`
+}
+
+// GET /users?limit=50&offset=0
+func (a *api) listUsersHandler(w http.ResponseWriter, r *http.Request) error {
+	q := listQuery{Limit: defaultPageSize}
+	if err := invalid(validate.Query(r.URL.Query(), &q)); err != nil {
+		return err
+	}
+	if q.Limit == 0 {
+		q.Limit = defaultPageSize
+	}
+
+	users, err := a.users.List(r.Context(), q.Limit, q.Offset)
+	if err != nil {
+		return repoError(err)
+	}
+	writeJSON(w, http.StatusOK, userList{Users: users, Limit: q.Limit, Offset: q.Offset})
+	return nil
+}
+
+// POST /users {"name":"Alice","email":"alice@example.com"}
+func (a *api) createUserHandler(w http.ResponseWriter, r *http.Request, body userRequest) error {
+	user, err := a.users.Create(r.Context(), repository.User{Name: body.Name, Email: body.Email})
+	if err != nil {
+		return repoError(err)
+	}
+
+	w.Header().Set("Location", "/users/"+strconv.FormatInt(user.ID, 10))
+	writeJSON(w, http.StatusCreated, user)
+	return nil
+}
+
+// GET /users/{id}
+func (a *api) getUserByIDHandler(w http.ResponseWriter, r *http.Request) error {
+	id, err := pathID(r)
+	if err != nil {
+		return err
+	}
+	user, err := a.users.Get(r.Context(), id)
+	if err != nil {
+		return repoError(err)
+	}
+	writeJSON(w, http.StatusOK, user)
+	return nil
+}
+
+// GET /user?id=123 (deprecated, use GET /users/{id})
+func (a *api) getUserHandler(w http.ResponseWriter, r *http.Request) error {
+	var q legacyQuery
+	if err := invalid(validate.Query(r.URL.Query(), &q)); err != nil {
+		return err
+	}
+	user, err := a.users.Get(r.Context(), q.ID)
+	if err != nil {
+		return repoError(err)
+	}
+	writeJSON(w, http.StatusOK, user)
+	return nil
+}
+
+// PUT /users/{id} replaces every writable field
+func (a *api) replaceUserHandler(w http.ResponseWriter, r *http.Request, body userRequest) error {
+	id, err := pathID(r)
+	if err != nil {
+		return err
+	}
+
+	user, err := a.users.Update(r.Context(), repository.User{ID: id, Name: body.Name, Email: body.Email})
+	if err != nil {
+		return repoError(err)
+	}
+	writeJSON(w, http.StatusOK, user)
+	return nil
+}
+
+// PATCH /users/{id} applies a JSON Merge Patch (RFC 7396)
+func (a *api) patchUserHandler(w http.ResponseWriter, r *http.Request, patch any) error {
+	id, err := pathID(r)
+	if err != nil {
+		return err
+	}
+
+	current, err := a.users.Get(r.Context(), id)
+	if err != nil {
+		return repoError(err)
+	}
+
+	doc := map[string]any{"name": current.Name, "email": current.Email}
+	merged, err := json.Marshal(mergePatch(doc, patch))
+	if err != nil {
+		return problem.BadRequest("invalid patch")
+	}
+	// the merged document goes through the same checks as a PUT body, which
+	// also rejects patches touching read-only or unknown fields
+	var body userRequest
+	if err := invalid(validate.Unmarshal(merged, &body)); err != nil {
+		return err
+	}
+
+	user, err := a.users.Update(r.Context(), repository.User{ID: id, Name: body.Name, Email: body.Email})
+	if err != nil {
+		return repoError(err)
+	}
+	writeJSON(w, http.StatusOK, user)
+	return nil
+}
+
+// DELETE /users/{id}
+func (a *api) deleteUserHandler(w http.ResponseWriter, r *http.Request) error {
+	id, err := pathID(r)
+	if err != nil {
+		return err
+	}
+	if err := a.users.Delete(r.Context(), id); err != nil {
+		return repoError(err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// pathID parses the {id} wildcard
+func pathID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, problem.BadRequest("invalid id %q", r.PathValue("id"))
+	}
+	return id, nil
+}
+
+// repoError maps repository errors to problems
+func repoError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return problem.NotFound("%s", err)
+	case errors.Is(err, repository.ErrConflict):
+		return problem.Conflict("%s", err)
+	default:
+		return problem.Internal(err)
+	}
+}
+
+// mergePatch applies an RFC 7396 merge patch to target: objects are merged
+// recursively, null removes a member and anything else replaces it
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
+
+// methodNotAllowed answers requests to a known path with an unsupported
+// method. GET implies HEAD, as it does for ServeMux patterns.
+func methodNotAllowed(methods ...string) http.Handler {
+	if slices.Contains(methods, http.MethodGet) {
+		methods = append(methods, http.MethodHead)
+	}
+	allow := strings.Join(methods, ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		problem.Write(w, r, http.StatusMethodNotAllowed, r.Method+" is not supported, use "+allow)
+	})
+}
+
+// deprecated marks responses from legacy routes (RFC 8594 style headers)
+func deprecated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", `</users>; rel="successor-version"`)
+		next.ServeHTTP(w, r)
+	})
+}
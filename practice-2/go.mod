@@ -1,3 +1,16 @@
-module practice2
+module tiny-http
 
 go 1.24.0
+
+require (
+	github.com/mattn/go-sqlite3 v1.14.19
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20251029180050-ab9386a59fda
+	google.golang.org/grpc v1.78.0
+	google.golang.org/protobuf v1.36.10
+)
+
+require (
+	golang.org/x/net v0.47.0 // indirect
+	golang.org/x/sys v0.38.0 // indirect
+	golang.org/x/text v0.31.0 // indirect
+)
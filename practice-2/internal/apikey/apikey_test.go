@@ -0,0 +1,170 @@
+package apikey_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tiny-http/internal/apikey"
+)
+
+// stores runs test against a store of every kind holding keys
+func stores(t *testing.T, keys []apikey.Key, test func(t *testing.T, store apikey.Store)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, apikey.NewMemoryStore(keys...))
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		store := newSQLiteStore(t)
+		ctx := context.Background()
+		for _, k := range keys {
+			if _, err := store.Create(ctx, k); err != nil {
+				t.Fatal(err)
+			}
+			if !k.RevokedAt.IsZero() {
+				if _, err := store.Revoke(ctx, k.ID); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		test(t, store)
+	})
+}
+
+func newSQLiteStore(t *testing.T) *apikey.SQLiteStore {
+	t.Helper()
+	store, err := apikey.NewSQLiteStore(filepath.Join(t.TempDir(), "keys.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+var testKeys = []apikey.Key{
+	{ID: "reader", Name: "reader", Tenant: "team-a", Hash: apikey.HashSecret("read-secret"), Scopes: []string{apikey.ScopeUsersRead}},
+	{ID: "writer", Name: "writer", Hash: apikey.HashSecret("write-secret"),
+		Scopes: []string{apikey.ScopeUsersRead, apikey.ScopeUsersWrite}, ExpiresAt: time.Now().Add(time.Hour)},
+	{ID: "old", Name: "old", Hash: apikey.HashSecret("old-secret"), Scopes: []string{apikey.ScopeUsersRead},
+		ExpiresAt: time.Now().Add(-time.Hour)},
+	{ID: "gone", Name: "gone", Hash: apikey.HashSecret("gone-secret"), Scopes: []string{apikey.ScopeUsersRead},
+		RevokedAt: time.Now().Add(-time.Hour)},
+}
+
+func TestLookup(t *testing.T) {
+	stores(t, testKeys, func(t *testing.T, store apikey.Store) {
+		ctx := context.Background()
+		tests := []struct {
+			secret string
+			want   string
+			err    error
+		}{
+			{"read-secret", "reader", nil},
+			{"write-secret", "writer", nil},
+			{"old-secret", "", apikey.ErrExpired},
+			{"gone-secret", "", apikey.ErrUnknownKey},
+			{"guess", "", apikey.ErrUnknownKey},
+			{"", "", apikey.ErrUnknownKey},
+			{"read-secreT", "", apikey.ErrUnknownKey},
+			// only the hash is stored, and it is not a secret that works
+			{apikey.HashSecret("read-secret"), "", apikey.ErrUnknownKey},
+		}
+		for _, tt := range tests {
+			k, err := store.Lookup(ctx, tt.secret)
+			if !errors.Is(err, tt.err) || k.ID != tt.want {
+				t.Errorf("Lookup(%q) = %q, %v; want %q, %v", tt.secret, k.ID, err, tt.want, tt.err)
+			}
+		}
+
+		k, err := store.Lookup(ctx, "read-secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k.Tenant != "team-a" || !k.HasScope(apikey.ScopeUsersRead) || k.HasScope(apikey.ScopeUsersWrite) {
+			t.Errorf("reader = %+v", k)
+		}
+	})
+}
+
+func TestLookupID(t *testing.T) {
+	stores(t, testKeys, func(t *testing.T, store apikey.Store) {
+		ctx := context.Background()
+		tests := []struct {
+			id  string
+			err error
+		}{
+			{"reader", nil},
+			{"old", apikey.ErrExpired},
+			{"gone", apikey.ErrUnknownKey},
+			{"nobody", apikey.ErrUnknownKey},
+		}
+		for _, tt := range tests {
+			if k, err := store.LookupID(ctx, tt.id); !errors.Is(err, tt.err) || (err == nil && k.ID != tt.id) {
+				t.Errorf("LookupID(%q) = %q, %v; want %v", tt.id, k.ID, err, tt.err)
+			}
+		}
+	})
+}
+
+func TestKey(t *testing.T) {
+	now := time.Now()
+	k := apikey.Key{Scopes: []string{apikey.ScopeUsersRead}, ExpiresAt: now}
+	if !k.Expired(now) || k.Expired(now.Add(-time.Second)) {
+		t.Error("a key expires at ExpiresAt")
+	}
+	if (apikey.Key{}).Expired(now) {
+		t.Error("a key without ExpiresAt expired")
+	}
+	if !k.HasScope(apikey.ScopeUsersRead) || k.HasScope(apikey.ScopeUsersWrite) || k.HasScope("users") {
+		t.Errorf("HasScope with scopes %v", k.Scopes)
+	}
+}
+
+func TestScopeFor(t *testing.T) {
+	for method, want := range map[string]string{
+		"GET": "users:read", "HEAD": "users:read", "OPTIONS": "users:read",
+		"POST": "users:write", "PUT": "users:write", "PATCH": "users:write", "DELETE": "users:write",
+	} {
+		if got := apikey.ScopeFor("users", method); got != want {
+			t.Errorf("ScopeFor(users, %s) = %q, want %q", method, got, want)
+		}
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	a, b := apikey.NewSecret(), apikey.NewSecret()
+	if a == b || !strings.HasPrefix(a, "tk_") || len(a) != 67 {
+		t.Errorf("secrets %q and %q", a, b)
+	}
+	// sha256("abc")
+	if got := apikey.HashSecret("abc"); got != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("HashSecret = %s", got)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	os.WriteFile(path, []byte(`[
+		{"id": "ci", "name": "ci", "hash": "`+apikey.HashSecret("ci-secret")+`", "scopes": ["users:read"]},
+		{"id": "revoked", "name": "revoked", "hash": "`+apikey.HashSecret("revoked-secret")+`",
+		 "revoked_at": "2024-01-01T00:00:00Z"}
+	]`), 0o600)
+	store, err := apikey.LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k, err := store.Lookup(context.Background(), "ci-secret"); err != nil || k.ID != "ci" {
+		t.Errorf("Lookup = %q, %v", k.ID, err)
+	}
+	if _, err := store.Lookup(context.Background(), "revoked-secret"); !errors.Is(err, apikey.ErrUnknownKey) {
+		t.Errorf("revoked key from the file: %v, want ErrUnknownKey", err)
+	}
+
+	os.WriteFile(path, []byte(`[{"id": "ci", "scopes": ["users:read"]}]`), 0o600)
+	if _, err := apikey.LoadFile(path); err == nil {
+		t.Error("loaded a key without a hash")
+	}
+}
@@ -0,0 +1,76 @@
+package apikey
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps keys in maps indexed by hash and id
+type MemoryStore struct {
+	mu     sync.RWMutex
+	byHash map[string]Key
+	byID   map[string]Key
+}
+
+// NewMemoryStore returns a store holding keys
+func NewMemoryStore(keys ...Key) *MemoryStore {
+	s := &MemoryStore{byHash: make(map[string]Key, len(keys)), byID: make(map[string]Key, len(keys))}
+	for _, k := range keys {
+		s.byHash[k.Hash] = k
+		s.byID[k.ID] = k
+	}
+	return s
+}
+
+// LoadFile reads a JSON array of keys from path, e.g.
+//
+//	[{"id": "ci-2024", "name": "ci", "tenant": "team-a", "hash": "<sha256 hex>",
+//	  "scopes": ["users:read"], "expires_at": "2025-01-01T00:00:00Z"}]
+//
+// A key with revoked_at set is kept but never accepted.
+func LoadFile(path string) (*MemoryStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key file: %w", err)
+	}
+	var keys []Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("parse key file %s: %w", path, err)
+	}
+	for i, k := range keys {
+		if k.ID == "" || k.Hash == "" {
+			return nil, fmt.Errorf("parse key file %s: entry %d needs id and hash", path, i)
+		}
+	}
+	return NewMemoryStore(keys...), nil
+}
+
+func (s *MemoryStore) Lookup(ctx context.Context, secret string) (Key, error) {
+	s.mu.RLock()
+	k, ok := s.byHash[HashSecret(secret)]
+	s.mu.RUnlock()
+	return valid(k, ok)
+}
+
+func (s *MemoryStore) LookupID(ctx context.Context, id string) (Key, error) {
+	s.mu.RLock()
+	k, ok := s.byID[id]
+	s.mu.RUnlock()
+	return valid(k, ok)
+}
+
+// valid applies the Lookup rules to a key found (or not) in one of the maps;
+// revoked keys count as unknown, as in SQLiteStore
+func valid(k Key, ok bool) (Key, error) {
+	if !ok || !k.RevokedAt.IsZero() {
+		return Key{}, ErrUnknownKey
+	}
+	if k.Expired(time.Now()) {
+		return Key{}, ErrExpired
+	}
+	return k, nil
+}
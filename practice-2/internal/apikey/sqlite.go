@@ -0,0 +1,214 @@
+package apikey
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"tiny-http/internal/migrate"
+	"tiny-http/internal/tenant"
+)
+
+// migrations bring the api_keys table up to date; append new steps, never
+// change applied ones
+var migrations = []migrate.Step{
+	migrate.Exec(`CREATE TABLE IF NOT EXISTS api_keys (
+		id         TEXT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		hash       TEXT NOT NULL UNIQUE,
+		scopes     TEXT NOT NULL DEFAULT '',
+		expires_at TIMESTAMP,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`),
+	migrate.AddColumn("api_keys", "last_used_at", "TIMESTAMP"),
+	migrate.AddColumn("api_keys", "revoked_at", "TIMESTAMP"),
+	migrate.AddColumn("api_keys", "tenant", "TEXT NOT NULL DEFAULT 'default'"),
+}
+
+// lastUsedResolution is how stale last_used_at may get before a lookup
+// writes it again, so busy keys don't cost a write per request
+const lastUsedResolution = time.Minute
+
+// SQLiteStore keeps keys in the api_keys table of a SQLite database. Unlike
+// the file-backed MemoryStore its keys can be created, revoked and changed
+// while the server runs, and it records when each key was last used.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens the database at path and migrates the api_keys
+// table
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite: %w", err)
+	}
+	if err := migrate.Apply(db, "api_keys", migrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+const keyColumns = "id, name, tenant, hash, scopes, expires_at, created_at, last_used_at, revoked_at"
+
+func scanKey(row interface{ Scan(...any) error }) (Key, error) {
+	var (
+		k                            Key
+		scopes                       string
+		expiresAt, lastUsed, revoked sql.NullTime
+	)
+	if err := row.Scan(&k.ID, &k.Name, &k.Tenant, &k.Hash, &scopes, &expiresAt, &k.CreatedAt, &lastUsed, &revoked); err != nil {
+		return Key{}, err
+	}
+	k.Scopes = strings.Fields(scopes)
+	k.ExpiresAt = expiresAt.Time
+	k.LastUsedAt = lastUsed.Time
+	k.RevokedAt = revoked.Time
+	return k, nil
+}
+
+// nullTime stores the zero time as NULL
+func nullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC()
+}
+
+// Lookup treats revoked keys as unknown
+func (s *SQLiteStore) Lookup(ctx context.Context, secret string) (Key, error) {
+	k, err := scanKey(s.db.QueryRowContext(ctx,
+		"SELECT "+keyColumns+" FROM api_keys WHERE hash = ? AND revoked_at IS NULL", HashSecret(secret),
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Key{}, ErrUnknownKey
+	}
+	if err != nil {
+		return Key{}, fmt.Errorf("lookup api key: %w", err)
+	}
+
+	now := time.Now()
+	if k.Expired(now) {
+		return Key{}, ErrExpired
+	}
+	if now.Sub(k.LastUsedAt) >= lastUsedResolution {
+		// a failed write only costs the last-used time, not the request
+		if _, err := s.db.ExecContext(ctx, "UPDATE api_keys SET last_used_at = ? WHERE id = ?", now.UTC(), k.ID); err != nil {
+			slog.WarnContext(ctx, "record api key use", "key_id", k.ID, "err", err)
+		}
+		k.LastUsedAt = now
+	}
+	return k, nil
+}
+
+// LookupID treats revoked keys as unknown, like Lookup. It does not count as
+// a use of the key.
+func (s *SQLiteStore) LookupID(ctx context.Context, id string) (Key, error) {
+	k, err := s.Get(ctx, id)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return Key{}, ErrUnknownKey
+	case err != nil:
+		return Key{}, err
+	case !k.RevokedAt.IsZero():
+		return Key{}, ErrUnknownKey
+	case k.Expired(time.Now()):
+		return Key{}, ErrExpired
+	}
+	return k, nil
+}
+
+// Create stores k, which must have an ID, Name and Hash, and returns it as
+// stored. It returns ErrExists if the id or secret is already in use.
+func (s *SQLiteStore) Create(ctx context.Context, k Key) (Key, error) {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO api_keys (id, name, tenant, hash, scopes, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		k.ID, k.Name, tenant.Name(k.Tenant), k.Hash, strings.Join(k.Scopes, " "), nullTime(k.ExpiresAt),
+	)
+	var serr sqlite3.Error
+	if errors.As(err, &serr) && (serr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey || serr.ExtendedCode == sqlite3.ErrConstraintUnique) {
+		return Key{}, ErrExists
+	}
+	if err != nil {
+		return Key{}, fmt.Errorf("create api key: %w", err)
+	}
+	return s.Get(ctx, k.ID)
+}
+
+// Get returns the key with the given id, revoked or not, or ErrNotFound
+func (s *SQLiteStore) Get(ctx context.Context, id string) (Key, error) {
+	k, err := scanKey(s.db.QueryRowContext(ctx, "SELECT "+keyColumns+" FROM api_keys WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Key{}, ErrNotFound
+	}
+	if err != nil {
+		return Key{}, fmt.Errorf("get api key %s: %w", id, err)
+	}
+	return k, nil
+}
+
+// List returns every key, including revoked and expired ones, ordered by
+// creation time
+func (s *SQLiteStore) List(ctx context.Context) ([]Key, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+keyColumns+" FROM api_keys ORDER BY created_at, id")
+	if err != nil {
+		return nil, fmt.Errorf("list api keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []Key{}
+	for rows.Next() {
+		k, err := scanKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("list api keys: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// Revoke disables the key with the given id for Lookup and LookupID, so it
+// can neither authenticate nor refresh tokens; access tokens already issued
+// stay valid until they expire. The row is kept so List still shows it.
+func (s *SQLiteStore) Revoke(ctx context.Context, id string) (Key, error) {
+	return s.update(ctx, id, "revoked_at = COALESCE(revoked_at, ?)", time.Now().UTC())
+}
+
+// SetExpiry changes when the key expires; the zero time removes the expiry.
+// Like SetScopes it applies from the next lookup, including token refresh.
+func (s *SQLiteStore) SetExpiry(ctx context.Context, id string, at time.Time) (Key, error) {
+	return s.update(ctx, id, "expires_at = ?", nullTime(at))
+}
+
+// SetScopes replaces the key's scopes
+func (s *SQLiteStore) SetScopes(ctx context.Context, id string, scopes []string) (Key, error) {
+	return s.update(ctx, id, "scopes = ?", strings.Join(scopes, " "))
+}
+
+// update applies set to the key with the given id and returns it
+func (s *SQLiteStore) update(ctx context.Context, id, set string, arg any) (Key, error) {
+	res, err := s.db.ExecContext(ctx, "UPDATE api_keys SET "+set+" WHERE id = ?", arg, id)
+	if err != nil {
+		return Key{}, fmt.Errorf("update api key %s: %w", id, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return Key{}, ErrNotFound
+	}
+	return s.Get(ctx, id)
+}
+
+// Ping checks that the database is reachable
+func (s *SQLiteStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,123 @@
+package apikey_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"tiny-http/internal/apikey"
+)
+
+func TestSQLiteManage(t *testing.T) {
+	store := newSQLiteStore(t)
+	ctx := context.Background()
+
+	k, err := store.Create(ctx, apikey.Key{ID: "ci", Name: "ci", Hash: apikey.HashSecret("ci-secret"), Scopes: []string{apikey.ScopeUsersRead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Tenant != "default" || k.CreatedAt.IsZero() || !k.LastUsedAt.IsZero() {
+		t.Errorf("created = %+v", k)
+	}
+	if _, err := store.Create(ctx, apikey.Key{ID: "ci", Name: "ci", Hash: apikey.HashSecret("other")}); !errors.Is(err, apikey.ErrExists) {
+		t.Errorf("same id: %v, want ErrExists", err)
+	}
+	if _, err := store.Create(ctx, apikey.Key{ID: "ci-2", Name: "ci", Hash: apikey.HashSecret("ci-secret")}); !errors.Is(err, apikey.ErrExists) {
+		t.Errorf("same secret: %v, want ErrExists", err)
+	}
+
+	k, err = store.SetScopes(ctx, "ci", []string{apikey.ScopeUsersRead, apikey.ScopeUsersWrite})
+	if err != nil || !slices.Equal(k.Scopes, []string{apikey.ScopeUsersRead, apikey.ScopeUsersWrite}) {
+		t.Errorf("SetScopes = %v, %v", k.Scopes, err)
+	}
+	if k, _ := store.Lookup(ctx, "ci-secret"); !k.HasScope(apikey.ScopeUsersWrite) {
+		t.Error("new scope not applied to the next lookup")
+	}
+
+	if _, err := store.SetExpiry(ctx, "ci", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Lookup(ctx, "ci-secret"); !errors.Is(err, apikey.ErrExpired) {
+		t.Errorf("after SetExpiry in the past: %v, want ErrExpired", err)
+	}
+	if _, err := store.SetExpiry(ctx, "ci", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Lookup(ctx, "ci-secret"); err != nil {
+		t.Errorf("after removing the expiry: %v", err)
+	}
+
+	revoked, err := store.Revoke(ctx, "ci")
+	if err != nil || revoked.RevokedAt.IsZero() {
+		t.Fatalf("Revoke = %+v, %v", revoked, err)
+	}
+	if again, _ := store.Revoke(ctx, "ci"); !again.RevokedAt.Equal(revoked.RevokedAt) {
+		t.Error("revoking twice moved revoked_at")
+	}
+	if _, err := store.Lookup(ctx, "ci-secret"); !errors.Is(err, apikey.ErrUnknownKey) {
+		t.Errorf("revoked key: %v, want ErrUnknownKey", err)
+	}
+	if keys, err := store.List(ctx); err != nil || len(keys) != 1 || keys[0].RevokedAt.IsZero() {
+		t.Errorf("List = %+v, %v; want the revoked key", keys, err)
+	}
+
+	for name, err := range map[string]error{
+		"Get":    errOf(store.Get(ctx, "nobody")),
+		"Revoke": errOf(store.Revoke(ctx, "nobody")),
+		"Scopes": errOf(store.SetScopes(ctx, "nobody", nil)),
+		"Expiry": errOf(store.SetExpiry(ctx, "nobody", time.Time{})),
+	} {
+		if !errors.Is(err, apikey.ErrNotFound) {
+			t.Errorf("%s of an unknown id: %v, want ErrNotFound", name, err)
+		}
+	}
+}
+
+func errOf(_ apikey.Key, err error) error { return err }
+
+func TestSQLiteRecordsUse(t *testing.T) {
+	store := newSQLiteStore(t)
+	ctx := context.Background()
+	if _, err := store.Create(ctx, apikey.Key{ID: "ci", Name: "ci", Hash: apikey.HashSecret("ci-secret")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.LookupID(ctx, "ci"); err != nil {
+		t.Fatal(err)
+	}
+	if k, _ := store.Get(ctx, "ci"); !k.LastUsedAt.IsZero() {
+		t.Error("LookupID counted as a use")
+	}
+
+	if _, err := store.Lookup(ctx, "ci-secret"); err != nil {
+		t.Fatal(err)
+	}
+	k, _ := store.Get(ctx, "ci")
+	if time.Since(k.LastUsedAt) > time.Minute {
+		t.Errorf("last_used_at = %v after a lookup", k.LastUsedAt)
+	}
+}
+
+func TestSQLiteReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.db")
+	store, err := apikey.NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create(context.Background(), apikey.Key{ID: "ci", Name: "ci", Hash: apikey.HashSecret("ci-secret")}); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = apikey.NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("reopening a migrated database: %v", err)
+	}
+	defer store.Close()
+	if _, err := store.Lookup(context.Background(), "ci-secret"); err != nil {
+		t.Errorf("key lost across reopen: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package certs
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Fields of a certificate a client can be matched on
+const (
+	FieldCommonName = "cn"
+	FieldDNS        = "dns"
+	FieldURI        = "uri"
+	FieldEmail      = "email"
+)
+
+// Client is a caller identified by its certificate. Subject is matched
+// against the certificate field named by Field only, so a certificate whose
+// email SAN happens to equal another client's common name doesn't
+// authenticate as that client. Tenant works as for API keys.
+type Client struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Tenant  string   `json:"tenant,omitempty"`
+	Field   string   `json:"field"`
+	Subject string   `json:"subject"`
+	Scopes  []string `json:"scopes"`
+}
+
+// subject is a value of one certificate field
+type subject struct {
+	field, value string
+}
+
+// ClientMap resolves verified client certificates to clients
+type ClientMap struct {
+	bySubject map[subject]Client
+}
+
+// NewClientMap indexes clients by field and subject
+func NewClientMap(clients ...Client) (*ClientMap, error) {
+	m := &ClientMap{bySubject: make(map[subject]Client, len(clients))}
+	for _, c := range clients {
+		if c.ID == "" || c.Subject == "" {
+			return nil, fmt.Errorf("client %q: id and subject are required", c.ID)
+		}
+		switch c.Field {
+		case FieldCommonName, FieldDNS, FieldURI, FieldEmail:
+		default:
+			return nil, fmt.Errorf("client %q: field %q is not one of cn, dns, uri or email", c.ID, c.Field)
+		}
+		key := subject{c.Field, c.Subject}
+		if _, dup := m.bySubject[key]; dup {
+			return nil, fmt.Errorf("client %q: %s %q is already mapped", c.ID, c.Field, c.Subject)
+		}
+		m.bySubject[key] = c
+	}
+	return m, nil
+}
+
+// LoadClientMap reads a JSON array of clients, e.g.
+//
+//	[{"id": "billing", "name": "billing", "field": "uri",
+//	  "subject": "spiffe://example.com/billing", "scopes": ["users:read"]}]
+func LoadClientMap(path string) (*ClientMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var clients []Client
+	if err := json.Unmarshal(data, &clients); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return NewClientMap(clients...)
+}
+
+// Lookup returns the client for cert, matching its common name and each SAN
+// against the clients configured for that field. A certificate matching
+// more than one client is refused rather than picking one. The certificate
+// must already have been verified.
+func (m *ClientMap) Lookup(cert *x509.Certificate) (Client, bool) {
+	subjects := []subject{{FieldCommonName, cert.Subject.CommonName}}
+	for _, n := range cert.DNSNames {
+		subjects = append(subjects, subject{FieldDNS, n})
+	}
+	for _, u := range cert.URIs {
+		subjects = append(subjects, subject{FieldURI, u.String()})
+	}
+	for _, e := range cert.EmailAddresses {
+		subjects = append(subjects, subject{FieldEmail, e})
+	}
+
+	var found Client
+	for _, s := range subjects {
+		c, ok := m.bySubject[s]
+		if !ok || s.value == "" {
+			continue
+		}
+		if found.ID != "" && found.ID != c.ID {
+			return Client{}, false
+		}
+		found = c
+	}
+	return found, found.ID != ""
+}
@@ -0,0 +1,88 @@
+package certs
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"testing"
+)
+
+func newClientMap(t *testing.T) *ClientMap {
+	t.Helper()
+	m, err := NewClientMap(
+		Client{ID: "billing", Field: FieldCommonName, Subject: "billing"},
+		Client{ID: "reports", Field: FieldDNS, Subject: "reports.internal"},
+		Client{ID: "spiffe", Field: FieldURI, Subject: "spiffe://example.com/worker"},
+		Client{ID: "ops", Field: FieldEmail, Subject: "ops@example.com"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestLookup(t *testing.T) {
+	worker, _ := url.Parse("spiffe://example.com/worker")
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		want string
+	}{
+		{"common name", &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}}, "billing"},
+		{"dns SAN", &x509.Certificate{DNSNames: []string{"other.internal", "reports.internal"}}, "reports"},
+		{"uri SAN", &x509.Certificate{URIs: []*url.URL{worker}}, "spiffe"},
+		{"email SAN", &x509.Certificate{EmailAddresses: []string{"ops@example.com"}}, "ops"},
+		{"same client twice", &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}, DNSNames: []string{"billing"}}, "billing"},
+		{"no match", &x509.Certificate{Subject: pkix.Name{CommonName: "stranger"}}, ""},
+		{"empty certificate", &x509.Certificate{}, ""},
+
+		// a SAN equal to a subject configured for another field must not match
+		{"common name as dns SAN", &x509.Certificate{DNSNames: []string{"billing"}}, ""},
+		{"common name as email SAN", &x509.Certificate{EmailAddresses: []string{"billing"}}, ""},
+		{"dns name as common name", &x509.Certificate{Subject: pkix.Name{CommonName: "reports.internal"}}, ""},
+		{"email as common name", &x509.Certificate{Subject: pkix.Name{CommonName: "ops@example.com"}}, ""},
+		{"uri as dns SAN", &x509.Certificate{DNSNames: []string{"spiffe://example.com/worker"}}, ""},
+
+		{"two clients", &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}, EmailAddresses: []string{"ops@example.com"}}, ""},
+	}
+	m := newClientMap(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, ok := m.Lookup(tt.cert)
+			if ok != (tt.want != "") || c.ID != tt.want {
+				t.Errorf("Lookup = %q, %v; want %q", c.ID, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewClientMapRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		clients []Client
+	}{
+		{"no id", []Client{{Field: FieldCommonName, Subject: "billing"}}},
+		{"no subject", []Client{{ID: "billing", Field: FieldCommonName}}},
+		{"no field", []Client{{ID: "billing", Subject: "billing"}}},
+		{"unknown field", []Client{{ID: "billing", Field: "ip", Subject: "10.0.0.1"}}},
+		{"duplicate", []Client{
+			{ID: "a", Field: FieldDNS, Subject: "billing.internal"},
+			{ID: "b", Field: FieldDNS, Subject: "billing.internal"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewClientMap(tt.clients...); err == nil {
+				t.Error("NewClientMap succeeded")
+			}
+		})
+	}
+
+	// the same subject under different fields names different things
+	if _, err := NewClientMap(
+		Client{ID: "a", Field: FieldCommonName, Subject: "billing"},
+		Client{ID: "b", Field: FieldDNS, Subject: "billing"},
+	); err != nil {
+		t.Errorf("same subject, different fields: %v", err)
+	}
+}
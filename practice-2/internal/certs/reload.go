@@ -0,0 +1,116 @@
+// Package certs loads the server's TLS material: certificates from disk that
+// are reloaded when they change, a self-signed certificate for development,
+// and the mapping from client certificates to caller identities.
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader serves a certificate and key pair from disk and picks up new
+// files when their modification time changes
+type Reloader struct {
+	certFile, keyFile string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewReloader loads the key pair, failing if it can't be parsed
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// latest returns the newer modification time of the two files
+func (r *Reloader) latest() (time.Time, error) {
+	var t time.Time
+	for _, f := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if fi.ModTime().After(t) {
+			t = fi.ModTime()
+		}
+	}
+	return t, nil
+}
+
+// reload reads the files again if they changed and reports whether it did.
+// On error the previous certificate stays in use.
+func (r *Reloader) reload() (bool, error) {
+	mod, err := r.latest()
+	if err != nil {
+		return false, err
+	}
+	r.mu.RLock()
+	same := r.cert != nil && mod.Equal(r.modTime)
+	r.mu.RUnlock()
+	if same {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("load key pair: %w", err)
+	}
+	r.mu.Lock()
+	r.cert, r.modTime = &cert, mod
+	r.mu.Unlock()
+	return true, nil
+}
+
+// GetCertificate is the tls.Config callback returning the current pair
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Watch checks the files every interval until ctx is done. Certificates
+// are usually replaced by writing both files, so a half-updated pair that
+// fails to load is retried on the next tick.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		changed, err := r.reload()
+		switch {
+		case err != nil:
+			slog.Warn("tls certificate reload failed, keeping the current one", "err", err)
+		case changed:
+			slog.Info("tls certificate reloaded", "cert", r.certFile)
+		}
+	}
+}
+
+// LoadCAPool reads PEM certificates trusted to sign client certificates
+func LoadCAPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New(path + ": no PEM certificates found")
+	}
+	return pool, nil
+}
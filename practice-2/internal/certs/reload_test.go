@@ -0,0 +1,130 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writePair writes a new self-signed pair for host with the given
+// modification time, returning its DER certificate
+func writePair(t *testing.T, certFile, keyFile, host string, mod time.Time) []byte {
+	t.Helper()
+	cert, err := SelfSigned(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), mod)
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), mod)
+	return cert.Certificate[0]
+}
+
+func writeFile(t *testing.T, path string, data []byte, mod time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func current(t *testing.T, r *Reloader) []byte {
+	t.Helper()
+	cert, err := r.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Certificate[0]
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	start := time.Now().Add(-time.Hour)
+	first := writePair(t, certFile, keyFile, "a.example.com", start)
+
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(current(t, r), first) {
+		t.Fatal("serving a different certificate than the one on disk")
+	}
+	if changed, err := r.reload(); changed || err != nil {
+		t.Errorf("unchanged files: reload = %v, %v", changed, err)
+	}
+
+	second := writePair(t, certFile, keyFile, "b.example.com", start.Add(time.Minute))
+	if changed, err := r.reload(); !changed || err != nil {
+		t.Fatalf("new files: reload = %v, %v", changed, err)
+	}
+	if !bytes.Equal(current(t, r), second) {
+		t.Error("still serving the old certificate")
+	}
+
+	// a half-written pair keeps the previous certificate and is retried
+	writeFile(t, keyFile, []byte("not a key"), start.Add(2*time.Minute))
+	if _, err := r.reload(); err == nil {
+		t.Error("mismatched pair loaded")
+	}
+	if !bytes.Equal(current(t, r), second) {
+		t.Error("a failed reload replaced the certificate")
+	}
+	third := writePair(t, certFile, keyFile, "c.example.com", start.Add(2*time.Minute))
+	if changed, err := r.reload(); !changed || err != nil || !bytes.Equal(current(t, r), third) {
+		t.Errorf("pair completed at the same time: reload = %v, %v", changed, err)
+	}
+}
+
+func TestNewReloaderFails(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	if _, err := NewReloader(certFile, keyFile); err == nil {
+		t.Error("missing files loaded")
+	}
+	writeFile(t, certFile, []byte("garbage"), time.Now())
+	writeFile(t, keyFile, []byte("garbage"), time.Now())
+	if _, err := NewReloader(certFile, keyFile); err == nil {
+		t.Error("garbage loaded")
+	}
+}
+
+func TestReloaderWatch(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	start := time.Now().Add(-time.Hour)
+	writePair(t, certFile, keyFile, "a.example.com", start)
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Watch(ctx, 5*time.Millisecond)
+		close(done)
+	}()
+	next := writePair(t, certFile, keyFile, "b.example.com", start.Add(time.Minute))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !bytes.Equal(current(t, r), next) {
+		if time.Now().After(deadline) {
+			t.Fatal("Watch didn't pick up the new certificate")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+}
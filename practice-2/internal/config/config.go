@@ -0,0 +1,650 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"tiny-http/internal/lockout"
+	"tiny-http/internal/ratelimit"
+	"tiny-http/internal/redis"
+)
+
+// Environments accepted in ENV
+const (
+	EnvDevelopment = "development"
+	EnvStaging     = "staging"
+	EnvProduction  = "production"
+)
+
+// Config is the typed server configuration
+type Config struct {
+	Env      string
+	Host     string
+	Port     int
+	LogLevel slog.Level
+
+	Server ServerConfig
+
+	TLS TLSConfig
+
+	// GRPCPort serves the gRPC user service on its own port; 0 disables it
+	GRPCPort int
+
+	// MetricsAddr is a separate host:port for /metrics; if empty the
+	// metrics are served on the main listener
+	MetricsAddr string
+
+	DB       DBConfig
+	RedisURL string
+
+	RateLimit RateLimitConfig
+
+	Lockout LockoutConfig
+
+	Tracing TracingConfig
+
+	// IdempotencyTTL is how long responses to Idempotency-Key requests are
+	// kept for replay, and IdempotencyMaxBytes how much memory they may take
+	IdempotencyTTL      time.Duration
+	IdempotencyMaxBytes int64
+
+	// CORS is disabled when CORS.Origins is empty
+	CORS CORSConfig
+
+	Compression CompressionConfig
+
+	JWTSecret        string
+	JWTExpiry        time.Duration
+	JWTRefreshExpiry time.Duration
+
+	// APIKey is a single fallback key used when neither KeysFile nor KeysDB
+	// is set
+	APIKey   string
+	KeysFile string
+	KeysDB   string
+
+	// SigningKeysFile enables HMAC request signing with the shared secrets
+	// it lists; signed timestamps may be SigningSkew away from server time
+	SigningKeysFile string
+	SigningSkew     time.Duration
+}
+
+// Span exporters accepted in TRACE_EXPORTER
+const (
+	TraceNone   = "none"
+	TraceStdout = "stdout"
+	TraceFile   = "file"
+	TraceOTLP   = "otlp"
+)
+
+// TracingConfig selects where request spans go
+type TracingConfig struct {
+	Exporter     string
+	File         string
+	OTLPEndpoint string
+	ServiceName  string
+}
+
+// LockoutConfig controls locking out clients that keep failing
+// authentication. Clients in Trusted are never locked out.
+type LockoutConfig struct {
+	Policy  lockout.Policy
+	Trusted []netip.Prefix
+}
+
+// TLSConfig selects HTTPS and client certificate authentication. TLS is on
+// when CertFile and KeyFile or SelfSigned are set; ClientCA and ClientMap
+// together enable mTLS.
+type TLSConfig struct {
+	CertFile   string
+	KeyFile    string
+	SelfSigned bool
+	ClientCA   string
+	ClientMap  string
+}
+
+// Enabled reports whether the server listens with TLS
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.SelfSigned
+}
+
+// CORSConfig is the browser cross-origin policy. It converts directly to
+// middleware.CORSOptions.
+type CORSConfig struct {
+	Origins     []string
+	Methods     []string
+	Headers     []string
+	Credentials bool
+	MaxAge      time.Duration
+}
+
+// CompressionConfig sets the smallest response body worth compressing and
+// the most a gzip request body may decompress to. It converts directly to
+// middleware.CompressOptions.
+type CompressionConfig struct {
+	MinSize        int
+	MaxRequestBody int64
+}
+
+// ServerConfig holds the http.Server limits and the shutdown timings
+type ServerConfig struct {
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
+	// ShutdownDelay is how long /readyz reports failure before the server
+	// stops accepting connections, so load balancers can stop routing to it.
+	// It should cover a few readiness probe intervals.
+	ShutdownDelay  time.Duration
+	MaxHeaderBytes int
+}
+
+// DBConfig holds the database settings. Path selects the SQLite user store;
+// Host through Password describe a networked database server.
+type DBConfig struct {
+	Path     string
+	Host     string
+	Port     int
+	Name     string
+	User     string
+	Password string
+}
+
+// RateLimitConfig selects the limiter backend and the per-route limits
+type RateLimitConfig struct {
+	// Backend is "memory" or "redis"; redis uses RedisURL
+	Backend string
+	Users   ratelimit.Limit
+	Auth    ratelimit.Limit
+}
+
+// Addr returns the host:port the server listens on
+func (c *Config) Addr() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
+
+// GRPCAddr returns the host:port the gRPC server listens on
+func (c *Config) GRPCAddr() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.GRPCPort))
+}
+
+// Production reports whether ENV is production
+func (c *Config) Production() bool {
+	return c.Env == EnvProduction
+}
+
+// ValidationError lists every problem found while loading the configuration
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e, "\n  - ")
+}
+
+// settings maps each environment variable to the command-line flag that
+// overrides it
+var settings = []struct {
+	env, flag, usage string
+}{
+	{"ENV", "env", "environment: development, staging or production"},
+	{"HOST", "host", "interface to listen on"},
+	{"PORT", "port", "port to listen on"},
+	{"LOG_LEVEL", "log-level", "debug, info, warn or error"},
+	{"READ_TIMEOUT", "read-timeout", "max time to read a whole request"},
+	{"READ_HEADER_TIMEOUT", "read-header-timeout", "max time to read request headers"},
+	{"WRITE_TIMEOUT", "write-timeout", "max time to write a response"},
+	{"IDLE_TIMEOUT", "idle-timeout", "how long keep-alive connections stay open"},
+	{"SHUTDOWN_TIMEOUT", "shutdown-timeout", "how long to drain in-flight requests on shutdown"},
+	{"SHUTDOWN_DELAY", "shutdown-delay", "how long readiness fails before the listener closes on shutdown; 0 closes at once"},
+	{"MAX_HEADER_BYTES", "max-header-bytes", "max size of request headers in bytes"},
+	{"TLS_CERT", "tls-cert", "PEM certificate file; serves HTTPS, reloaded when it changes"},
+	{"TLS_KEY", "tls-key", "PEM private key file for TLS_CERT"},
+	{"TLS_SELF_SIGNED", "tls-self-signed", "serve HTTPS with a generated certificate (development only): true or false"},
+	{"TLS_CLIENT_CA", "tls-client-ca", "PEM CA bundle for verifying client certificates (enables mTLS)"},
+	{"TLS_CLIENT_MAP", "tls-client-map", "JSON file mapping client certificate fields to identities"},
+	{"GRPC_PORT", "grpc-port", "port for the gRPC user service (gRPC off if empty)"},
+	{"METRICS_ADDR", "metrics-addr", "separate host:port for /metrics (served on the main port if empty)"},
+	{"DB_PATH", "db", "path to the SQLite user database (in-memory store if empty)"},
+	{"DB_HOST", "db-host", "database host"},
+	{"DB_PORT", "db-port", "database port"},
+	{"DB_NAME", "db-name", "database name"},
+	{"DB_USER", "db-user", "database user"},
+	{"DB_PASSWORD", "db-password", "database password"},
+	{"REDIS_URL", "redis-url", "redis://host:port URL, rediss:// for TLS"},
+	{"RATE_LIMIT_BACKEND", "rate-limit-backend", "rate limiter backend: memory or redis"},
+	{"RATE_LIMIT_USERS", "rate-limit-users", "limit for /user, e.g. 60/1m"},
+	{"RATE_LIMIT_AUTH", "rate-limit-auth", "limit for /auth/*, e.g. 10/1m"},
+	{"LOCKOUT_THRESHOLD", "lockout-threshold", "failed authentications within LOCKOUT_WINDOW that lock a client IP or key prefix out"},
+	{"LOCKOUT_WINDOW", "lockout-window", "period over which failed authentications are counted"},
+	{"LOCKOUT_BASE", "lockout-base", "first lockout length; each further lockout doubles it"},
+	{"LOCKOUT_MAX", "lockout-max", "longest lockout"},
+	{"LOCKOUT_TRUSTED_NETWORKS", "lockout-trusted", "comma-separated CIDRs or IPs that are never locked out"},
+	{"TRACE_EXPORTER", "trace-exporter", "where spans go: none, stdout, file or otlp"},
+	{"TRACE_FILE", "trace-file", "file spans are appended to with TRACE_EXPORTER=file"},
+	{"OTEL_EXPORTER_OTLP_ENDPOINT", "otlp-endpoint", "OTLP/HTTP collector base URL with TRACE_EXPORTER=otlp"},
+	{"OTEL_SERVICE_NAME", "service-name", "service name reported with spans"},
+	{"IDEMPOTENCY_TTL", "idempotency-ttl", "how long Idempotency-Key responses are kept for replay"},
+	{"IDEMPOTENCY_MAX_BYTES", "idempotency-max-bytes", "memory kept for Idempotency-Key responses; the oldest are dropped first"},
+	{"CORS_ORIGINS", "cors-origins", "comma-separated allowed origins: exact, https://*.example.com or * (CORS off if empty)"},
+	{"CORS_METHODS", "cors-methods", "comma-separated methods allowed cross-origin"},
+	{"CORS_HEADERS", "cors-headers", "comma-separated request headers allowed cross-origin"},
+	{"CORS_CREDENTIALS", "cors-credentials", "allow cookies and auth headers cross-origin: true or false; needs listed CORS_ORIGINS, not *"},
+	{"CORS_MAX_AGE", "cors-max-age", "how long browsers may cache a preflight"},
+	{"COMPRESS_MIN_SIZE", "compress-min-size", "smallest response body in bytes that is gzip or deflate encoded"},
+	{"COMPRESS_MAX_REQUEST_BODY", "compress-max-request-body", "max size in bytes of a gzip request body once decompressed"},
+	{"JWT_SECRET", "jwt-secret", "HMAC secret for bearer tokens (bearer auth disabled if empty)"},
+	{"JWT_EXPIRY", "jwt-expiry", "access token lifetime"},
+	{"JWT_REFRESH_EXPIRY", "jwt-refresh-expiry", "refresh token lifetime (7x JWT_EXPIRY if empty)"},
+	{"API_KEY", "api-key", "single API key used when no key file or database is set"},
+	{"API_KEYS_FILE", "keys", "path to a JSON file of API keys"},
+	{"API_KEYS_DB", "keys-db", "path to a SQLite database of API keys, managed with cmd/admin"},
+	{"SIGNING_KEYS_FILE", "signing-keys", "path to a JSON file of HMAC signing keys (request signing off if empty)"},
+	{"SIGNING_MAX_SKEW", "signing-max-skew", "how far a signed request's timestamp may be from server time"},
+}
+
+// defaults apply when a setting is missing from every source
+var defaults = map[string]string{
+	"ENV":        EnvDevelopment,
+	"HOST":       "",
+	"PORT":       "8080",
+	"LOG_LEVEL":  "info",
+	"JWT_EXPIRY": "24h",
+
+	"READ_TIMEOUT":        "15s",
+	"READ_HEADER_TIMEOUT": "5s",
+	"WRITE_TIMEOUT":       "30s",
+	"IDLE_TIMEOUT":        "60s",
+	"SHUTDOWN_TIMEOUT":    "20s",
+	"SHUTDOWN_DELAY":      "5s",
+	"MAX_HEADER_BYTES":    "1048576",
+
+	"TLS_SELF_SIGNED": "false",
+
+	"RATE_LIMIT_BACKEND": "memory",
+	"RATE_LIMIT_USERS":   "60/1m",
+	"RATE_LIMIT_AUTH":    "10/1m",
+
+	"LOCKOUT_THRESHOLD": "5",
+	"LOCKOUT_WINDOW":    "15m",
+	"LOCKOUT_BASE":      "1m",
+	"LOCKOUT_MAX":       "1h",
+
+	"IDEMPOTENCY_TTL":       "24h",
+	"IDEMPOTENCY_MAX_BYTES": "67108864",
+
+	"COMPRESS_MIN_SIZE":         "1024",
+	"COMPRESS_MAX_REQUEST_BODY": "1048576",
+
+	"TRACE_EXPORTER":              TraceNone,
+	"OTEL_EXPORTER_OTLP_ENDPOINT": "http://localhost:4318",
+	"OTEL_SERVICE_NAME":           "tiny-http",
+
+	"SIGNING_MAX_SKEW": "5m",
+
+	"CORS_METHODS": "GET,HEAD,POST,PUT,PATCH,DELETE",
+	"CORS_HEADERS": "Content-Type,Authorization,X-API-Key,X-Request-ID,Idempotency-Key,X-Tenant-ID," +
+		"X-Signature,X-Signature-Key-Id,X-Signature-Timestamp,X-Signature-Nonce",
+	"CORS_CREDENTIALS": "false",
+	"CORS_MAX_AGE":     "10m",
+}
+
+// Load reads the configuration from, in increasing priority, built-in
+// defaults, the .env file, environment variables and the command-line args.
+// All problems are reported together as a ValidationError.
+func Load(args []string) (*Config, error) {
+	fset := flag.NewFlagSet("api", flag.ContinueOnError)
+	envFile := fset.String("env-file", ".env", "path to the .env file")
+	flagVals := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		flagVals[s.env] = fset.String(s.flag, "", s.usage+" ("+s.env+")")
+	}
+	if err := fset.Parse(args); err != nil {
+		return nil, err
+	}
+
+	vals := make(map[string]string, len(settings))
+	for k, v := range defaults {
+		vals[k] = v
+	}
+
+	fileVals, err := readDotEnv(*envFile)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && !isFlagSet(fset, "env-file"):
+		// a missing default .env is fine
+	case err != nil:
+		return nil, ValidationError{err.Error()}
+	}
+	for _, s := range settings {
+		if v, ok := fileVals[s.env]; ok {
+			vals[s.env] = v
+		}
+		if v, ok := os.LookupEnv(s.env); ok {
+			vals[s.env] = v
+		}
+	}
+	fset.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag == f.Name {
+				vals[s.env] = *flagVals[s.env]
+			}
+		}
+	})
+
+	return parse(vals)
+}
+
+func isFlagSet(fset *flag.FlagSet, name string) bool {
+	set := false
+	fset.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// parse converts raw values into a Config and validates them
+func parse(vals map[string]string) (*Config, error) {
+	var problems ValidationError
+	c := &Config{
+		Env:         vals["ENV"],
+		Host:        vals["HOST"],
+		RedisURL:    vals["REDIS_URL"],
+		MetricsAddr: vals["METRICS_ADDR"],
+		DB: DBConfig{
+			Path:     vals["DB_PATH"],
+			Host:     vals["DB_HOST"],
+			Name:     vals["DB_NAME"],
+			User:     vals["DB_USER"],
+			Password: vals["DB_PASSWORD"],
+		},
+		RateLimit: RateLimitConfig{Backend: vals["RATE_LIMIT_BACKEND"]},
+		JWTSecret: vals["JWT_SECRET"],
+		APIKey:    vals["API_KEY"],
+		KeysFile:  vals["API_KEYS_FILE"],
+		KeysDB:    vals["API_KEYS_DB"],
+
+		SigningKeysFile: vals["SIGNING_KEYS_FILE"],
+	}
+
+	switch c.Env {
+	case EnvDevelopment, EnvStaging, EnvProduction:
+	default:
+		problems = append(problems, fmt.Sprintf("ENV: %q is not one of development, staging, production", c.Env))
+	}
+
+	c.Port = parsePort(&problems, "PORT", vals["PORT"])
+	if v := vals["GRPC_PORT"]; v != "" {
+		c.GRPCPort = parsePort(&problems, "GRPC_PORT", v)
+		if c.GRPCPort == c.Port {
+			problems = append(problems, "GRPC_PORT must differ from PORT")
+		}
+	}
+
+	c.TLS = TLSConfig{
+		CertFile:  vals["TLS_CERT"],
+		KeyFile:   vals["TLS_KEY"],
+		ClientCA:  vals["TLS_CLIENT_CA"],
+		ClientMap: vals["TLS_CLIENT_MAP"],
+	}
+	if b, err := strconv.ParseBool(vals["TLS_SELF_SIGNED"]); err != nil {
+		problems = append(problems, fmt.Sprintf("TLS_SELF_SIGNED: %q is not true or false", vals["TLS_SELF_SIGNED"]))
+	} else {
+		c.TLS.SelfSigned = b
+	}
+	switch {
+	case (c.TLS.CertFile == "") != (c.TLS.KeyFile == ""):
+		problems = append(problems, "TLS_CERT and TLS_KEY must be set together")
+	case c.TLS.CertFile != "" && c.TLS.SelfSigned:
+		problems = append(problems, "TLS_SELF_SIGNED can't be combined with TLS_CERT")
+	case c.TLS.SelfSigned && c.Env == EnvProduction:
+		problems = append(problems, "TLS_SELF_SIGNED is not allowed in production")
+	}
+	if (c.TLS.ClientCA == "") != (c.TLS.ClientMap == "") {
+		problems = append(problems, "TLS_CLIENT_CA and TLS_CLIENT_MAP must be set together")
+	} else if c.TLS.ClientCA != "" && !c.TLS.Enabled() {
+		problems = append(problems, "TLS_CLIENT_CA needs TLS_CERT or TLS_SELF_SIGNED")
+	}
+	if c.MetricsAddr != "" {
+		if _, port, err := net.SplitHostPort(c.MetricsAddr); err != nil || port == "" {
+			problems = append(problems, fmt.Sprintf("METRICS_ADDR: %q is not a host:port address", c.MetricsAddr))
+		}
+	}
+	if vals["DB_PORT"] != "" {
+		c.DB.Port = parsePort(&problems, "DB_PORT", vals["DB_PORT"])
+	}
+
+	if err := c.LogLevel.UnmarshalText([]byte(vals["LOG_LEVEL"])); err != nil {
+		problems = append(problems, fmt.Sprintf("LOG_LEVEL: %q is not one of debug, info, warn, error", vals["LOG_LEVEL"]))
+	}
+
+	c.Server = ServerConfig{
+		ReadTimeout:       parseDuration(&problems, "READ_TIMEOUT", vals["READ_TIMEOUT"]),
+		ReadHeaderTimeout: parseDuration(&problems, "READ_HEADER_TIMEOUT", vals["READ_HEADER_TIMEOUT"]),
+		WriteTimeout:      parseDuration(&problems, "WRITE_TIMEOUT", vals["WRITE_TIMEOUT"]),
+		IdleTimeout:       parseDuration(&problems, "IDLE_TIMEOUT", vals["IDLE_TIMEOUT"]),
+		ShutdownTimeout:   parseDuration(&problems, "SHUTDOWN_TIMEOUT", vals["SHUTDOWN_TIMEOUT"]),
+	}
+	if d, err := time.ParseDuration(vals["SHUTDOWN_DELAY"]); err != nil || d < 0 {
+		problems = append(problems, fmt.Sprintf("SHUTDOWN_DELAY: %q is not a duration like 5s, or 0", vals["SHUTDOWN_DELAY"]))
+	} else {
+		c.Server.ShutdownDelay = d
+	}
+	if n, err := strconv.Atoi(vals["MAX_HEADER_BYTES"]); err != nil || n < 4096 {
+		problems = append(problems, fmt.Sprintf("MAX_HEADER_BYTES: %q is not a size of at least 4096 bytes", vals["MAX_HEADER_BYTES"]))
+	} else {
+		c.Server.MaxHeaderBytes = n
+	}
+
+	if n, err := strconv.Atoi(vals["COMPRESS_MIN_SIZE"]); err != nil || n < 0 {
+		problems = append(problems, fmt.Sprintf("COMPRESS_MIN_SIZE: %q is not a size in bytes", vals["COMPRESS_MIN_SIZE"]))
+	} else {
+		c.Compression.MinSize = n
+	}
+	if n, err := strconv.ParseInt(vals["COMPRESS_MAX_REQUEST_BODY"], 10, 64); err != nil || n < 1 {
+		problems = append(problems, fmt.Sprintf("COMPRESS_MAX_REQUEST_BODY: %q is not a positive size in bytes", vals["COMPRESS_MAX_REQUEST_BODY"]))
+	} else {
+		c.Compression.MaxRequestBody = n
+	}
+
+	c.JWTExpiry = parseDuration(&problems, "JWT_EXPIRY", vals["JWT_EXPIRY"])
+	if v := vals["JWT_REFRESH_EXPIRY"]; v != "" {
+		c.JWTRefreshExpiry = parseDuration(&problems, "JWT_REFRESH_EXPIRY", v)
+	} else {
+		c.JWTRefreshExpiry = 7 * c.JWTExpiry
+	}
+
+	if c.RedisURL != "" {
+		// parse it the way the client will at startup
+		if _, err := redis.New(c.RedisURL); err != nil {
+			problems = append(problems, fmt.Sprintf("REDIS_URL: %q is not a redis:// or rediss:// URL", c.RedisURL))
+		}
+	}
+
+	switch c.RateLimit.Backend {
+	case "memory":
+	case "redis":
+		if c.RedisURL == "" {
+			problems = append(problems, "RATE_LIMIT_BACKEND: redis needs REDIS_URL")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("RATE_LIMIT_BACKEND: %q is not one of memory, redis", c.RateLimit.Backend))
+	}
+	c.RateLimit.Users = parseLimit(&problems, "RATE_LIMIT_USERS", vals["RATE_LIMIT_USERS"])
+	c.RateLimit.Auth = parseLimit(&problems, "RATE_LIMIT_AUTH", vals["RATE_LIMIT_AUTH"])
+
+	c.Lockout.Policy = lockout.Policy{
+		Window: parseDuration(&problems, "LOCKOUT_WINDOW", vals["LOCKOUT_WINDOW"]),
+		Base:   parseDuration(&problems, "LOCKOUT_BASE", vals["LOCKOUT_BASE"]),
+		Max:    parseDuration(&problems, "LOCKOUT_MAX", vals["LOCKOUT_MAX"]),
+	}
+	if n, err := strconv.Atoi(vals["LOCKOUT_THRESHOLD"]); err != nil || n < 1 {
+		problems = append(problems, fmt.Sprintf("LOCKOUT_THRESHOLD: %q is not a positive number", vals["LOCKOUT_THRESHOLD"]))
+	} else {
+		c.Lockout.Policy.Threshold = n
+	}
+	if c.Lockout.Policy.Max < c.Lockout.Policy.Base {
+		problems = append(problems, "LOCKOUT_MAX must not be shorter than LOCKOUT_BASE")
+	}
+	for _, n := range splitList(vals["LOCKOUT_TRUSTED_NETWORKS"]) {
+		p, err := netip.ParsePrefix(n)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(n)
+			if aerr != nil {
+				problems = append(problems, fmt.Sprintf("LOCKOUT_TRUSTED_NETWORKS: %q is not a CIDR or IP address", n))
+				continue
+			}
+			p = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		c.Lockout.Trusted = append(c.Lockout.Trusted, p.Masked())
+	}
+
+	c.Tracing = TracingConfig{
+		Exporter:     vals["TRACE_EXPORTER"],
+		File:         vals["TRACE_FILE"],
+		OTLPEndpoint: strings.TrimSuffix(vals["OTEL_EXPORTER_OTLP_ENDPOINT"], "/"),
+		ServiceName:  vals["OTEL_SERVICE_NAME"],
+	}
+	switch c.Tracing.Exporter {
+	case TraceNone, TraceStdout:
+	case TraceFile:
+		if c.Tracing.File == "" {
+			problems = append(problems, "TRACE_EXPORTER: file needs TRACE_FILE")
+		}
+	case TraceOTLP:
+		if u, err := url.Parse(c.Tracing.OTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("OTEL_EXPORTER_OTLP_ENDPOINT: %q is not an http(s) URL", c.Tracing.OTLPEndpoint))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("TRACE_EXPORTER: %q is not one of none, stdout, file, otlp", c.Tracing.Exporter))
+	}
+
+	c.SigningSkew = parseDuration(&problems, "SIGNING_MAX_SKEW", vals["SIGNING_MAX_SKEW"])
+	c.IdempotencyTTL = parseDuration(&problems, "IDEMPOTENCY_TTL", vals["IDEMPOTENCY_TTL"])
+	if n, err := strconv.ParseInt(vals["IDEMPOTENCY_MAX_BYTES"], 10, 64); err != nil || n < 1 {
+		problems = append(problems, fmt.Sprintf("IDEMPOTENCY_MAX_BYTES: %q is not a positive size in bytes", vals["IDEMPOTENCY_MAX_BYTES"]))
+	} else {
+		c.IdempotencyMaxBytes = n
+	}
+
+	c.CORS = CORSConfig{
+		Origins: splitList(vals["CORS_ORIGINS"]),
+		Methods: splitList(strings.ToUpper(vals["CORS_METHODS"])),
+		Headers: splitList(vals["CORS_HEADERS"]),
+		MaxAge:  parseDuration(&problems, "CORS_MAX_AGE", vals["CORS_MAX_AGE"]),
+	}
+	for _, o := range c.CORS.Origins {
+		if !validOrigin(o) {
+			problems = append(problems, fmt.Sprintf("CORS_ORIGINS: %q is not *, an origin like https://app.example.com or https://*.example.com", o))
+		}
+	}
+	if b, err := strconv.ParseBool(vals["CORS_CREDENTIALS"]); err != nil {
+		problems = append(problems, fmt.Sprintf("CORS_CREDENTIALS: %q is not true or false", vals["CORS_CREDENTIALS"]))
+	} else {
+		c.CORS.Credentials = b
+	}
+	// with any origin allowed, credentials would let every website call the
+	// API as the browser's user
+	if c.CORS.Credentials && slices.Contains(c.CORS.Origins, "*") {
+		problems = append(problems, "CORS_CREDENTIALS: true needs CORS_ORIGINS to list the origins, not *")
+	}
+
+	if c.APIKey == "" && c.KeysFile == "" && c.KeysDB == "" {
+		problems = append(problems, "no API keys configured: set API_KEYS_FILE, API_KEYS_DB or API_KEY")
+	}
+
+	if c.Production() {
+		requireSecret(&problems, "JWT_SECRET", c.JWTSecret)
+		if c.KeysFile == "" && c.KeysDB == "" {
+			requireSecret(&problems, "API_KEY", c.APIKey)
+		}
+		if c.DB.Host != "" {
+			requireSecret(&problems, "DB_PASSWORD", c.DB.Password)
+		}
+	} else {
+		// anyone can read the template, so a token signed with its secret
+		// could claim any scope and tenant
+		if c.JWTSecret != "" && templateSecret(c.JWTSecret) {
+			problems = append(problems, "JWT_SECRET: the .env template value can't sign tokens; set a random secret or leave it empty to disable bearer tokens")
+		}
+		if c.Env != EnvDevelopment && c.KeysFile == "" && c.KeysDB == "" && c.APIKey != "" && templateSecret(c.APIKey) {
+			problems = append(problems, "API_KEY: the .env template value is only accepted in development")
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	return c, nil
+}
+
+func parsePort(problems *ValidationError, name, v string) int {
+	p, err := strconv.Atoi(v)
+	if err != nil || p < 1 || p > 65535 {
+		*problems = append(*problems, fmt.Sprintf("%s: %q is not a port between 1 and 65535", name, v))
+		return 0
+	}
+	return p
+}
+
+func parseDuration(problems *ValidationError, name, v string) time.Duration {
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		*problems = append(*problems, fmt.Sprintf("%s: %q is not a positive duration like 15m or 24h", name, v))
+		return 0
+	}
+	return d
+}
+
+func parseLimit(problems *ValidationError, name, v string) ratelimit.Limit {
+	l, err := ratelimit.ParseLimit(v)
+	if err != nil {
+		*problems = append(*problems, name+": "+err.Error())
+	}
+	return l
+}
+
+// requireSecret rejects empty secrets and values copied unchanged from the
+// .env template
+func requireSecret(problems *ValidationError, name, v string) {
+	if v == "" || templateSecret(v) {
+		*problems = append(*problems, name+": a real secret is required in production")
+	}
+}
+
+// templateSecret reports whether v is a placeholder from the .env template
+func templateSecret(v string) bool {
+	return strings.HasPrefix(v, "your-") || v == "password" || v == "changeme"
+}
+
+// splitList splits a comma-separated setting, dropping empty items
+func splitList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// validOrigin accepts "*", scheme://host[:port] and scheme://*.host[:port]
+func validOrigin(pattern string) bool {
+	if pattern == "*" {
+		return true
+	}
+	u, err := url.Parse(strings.Replace(pattern, "://*.", "://wildcard.", 1))
+	return err == nil && u.Scheme != "" && u.Host != "" && !strings.Contains(u.Host, "*") &&
+		(u.Path == "" || u.Path == "/") && u.RawQuery == "" && u.Fragment == "" && u.User == nil
+}
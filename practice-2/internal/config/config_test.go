@@ -0,0 +1,243 @@
+package config
+
+import (
+	"errors"
+	"log/slog"
+	"maps"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// values returns the defaults with the API key every valid config needs,
+// overridden by kv pairs
+func values(kv ...string) map[string]string {
+	vals := maps.Clone(defaults)
+	vals["API_KEY"] = "dev-key"
+	for i := 0; i < len(kv); i += 2 {
+		vals[kv[i]] = kv[i+1]
+	}
+	return vals
+}
+
+// problemsOf returns the problems parse reported, failing if it didn't
+// return a ValidationError
+func problemsOf(t *testing.T, err error) ValidationError {
+	t.Helper()
+	var verr ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("error = %v, want a ValidationError", err)
+	}
+	return verr
+}
+
+// hasProblem reports whether one of problems is about name
+func hasProblem(problems ValidationError, name string) bool {
+	return slices.ContainsFunc(problems, func(p string) bool { return strings.HasPrefix(p, name+":") })
+}
+
+func TestCORSCredentials(t *testing.T) {
+	_, err := parse(values("CORS_ORIGINS", "*", "CORS_CREDENTIALS", "true"))
+	if !hasProblem(problemsOf(t, err), "CORS_CREDENTIALS") {
+		t.Errorf("credentials with any origin: problems = %v", err)
+	}
+
+	c, err := parse(values("CORS_ORIGINS", "https://app.example.com", "CORS_CREDENTIALS", "true"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.CORS.Credentials {
+		t.Error("credentials for a listed origin were dropped")
+	}
+}
+
+// clearEnv unsets every setting for the test so the caller's environment
+// can't leak into Load
+func clearEnv(t *testing.T) {
+	for _, s := range settings {
+		t.Setenv(s.env, "")
+		os.Unsetenv(s.env)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	clearEnv(t)
+	envFile := filepath.Join(t.TempDir(), ".env")
+	err := os.WriteFile(envFile, []byte(`# comment
+API_KEY=dev-key
+PORT=8081
+LOG_LEVEL=debug
+export READ_TIMEOUT="7s"
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LOG_LEVEL", "warn")
+	t.Setenv("READ_TIMEOUT", "8s")
+
+	c, err := Load([]string{"-env-file", envFile, "-read-timeout", "9s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Server.WriteTimeout != 30*time.Second {
+		t.Errorf("WRITE_TIMEOUT = %v, want the default 30s", c.Server.WriteTimeout)
+	}
+	if c.Port != 8081 {
+		t.Errorf("PORT = %d, want 8081 from .env over the default", c.Port)
+	}
+	if c.LogLevel != slog.LevelWarn {
+		t.Errorf("LOG_LEVEL = %v, want warn from the environment over .env", c.LogLevel)
+	}
+	if c.Server.ReadTimeout != 9*time.Second {
+		t.Errorf("READ_TIMEOUT = %v, want 9s from the flag over the environment", c.Server.ReadTimeout)
+	}
+}
+
+func TestLoadEnvFile(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("API_KEY", "dev-key")
+
+	// the default .env may be missing, one named explicitly may not
+	t.Chdir(t.TempDir())
+	if _, err := Load(nil); err != nil {
+		t.Errorf("without a .env: %v", err)
+	}
+	if _, err := Load([]string{"-env-file", "missing.env"}); err == nil {
+		t.Error("a missing -env-file was accepted")
+	}
+
+	os.WriteFile(".env", []byte("PORT 8080\n"), 0o600)
+	_, err := Load(nil)
+	if problems := problemsOf(t, err); !strings.Contains(problems[0], ".env:1") {
+		t.Errorf("malformed line: problems = %v, want the line reported", problems)
+	}
+}
+
+func TestParseReportsEveryProblem(t *testing.T) {
+	_, err := parse(values(
+		"ENV", "prod",
+		"PORT", "http",
+		"READ_TIMEOUT", "soon",
+		"RATE_LIMIT_USERS", "lots",
+		"TRACE_EXPORTER", "jaeger",
+	))
+	problems := problemsOf(t, err)
+	for _, name := range []string{"ENV", "PORT", "READ_TIMEOUT", "RATE_LIMIT_USERS", "TRACE_EXPORTER"} {
+		if !hasProblem(problems, name) {
+			t.Errorf("no problem reported for %s in %v", name, problems)
+		}
+	}
+	if len(problems) != 5 {
+		t.Errorf("%d problems, want 5: %v", len(problems), problems)
+	}
+	if msg := err.Error(); strings.Count(msg, "\n  - ") != 5 {
+		t.Errorf("Error() = %q, want one line per problem", msg)
+	}
+}
+
+func TestParseSecrets(t *testing.T) {
+	tests := []struct {
+		name string
+		vals map[string]string
+		want []string // settings with a problem
+	}{
+		{"template JWT secret in development",
+			values("JWT_SECRET", "your-jwt-secret-here"), []string{"JWT_SECRET"}},
+		{"template API key in development",
+			values("API_KEY", "your-api-key-here"), nil},
+		{"template API key in staging",
+			values("ENV", "staging", "API_KEY", "your-api-key-here"), []string{"API_KEY"}},
+		{"production templates",
+			values("ENV", "production", "JWT_SECRET", "your-jwt-secret-here", "API_KEY", "changeme",
+				"DB_HOST", "db", "DB_PASSWORD", "password"),
+			[]string{"JWT_SECRET", "API_KEY", "DB_PASSWORD"}},
+		{"production without secrets",
+			values("ENV", "production", "API_KEY", "", "API_KEYS_FILE", "keys.json", "DB_HOST", "db"),
+			[]string{"JWT_SECRET", "DB_PASSWORD"}},
+		{"production with real secrets",
+			values("ENV", "production", "JWT_SECRET", "8f2c0e6d1b", "API_KEY", "k-3d9a", "DB_HOST", "db", "DB_PASSWORD", "s3cr3t-pw"),
+			nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parse(tt.vals)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected problems: %v", err)
+				}
+				return
+			}
+			problems := problemsOf(t, err)
+			for _, name := range tt.want {
+				if !hasProblem(problems, name) {
+					t.Errorf("no problem reported for %s in %v", name, problems)
+				}
+			}
+			if len(problems) != len(tt.want) {
+				t.Errorf("problems = %v, want only %v", problems, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseValues(t *testing.T) {
+	tests := []struct {
+		name, key, val string
+		ok             bool
+	}{
+		{"duration", "READ_TIMEOUT", "90s", true},
+		{"duration without unit", "READ_TIMEOUT", "15", false},
+		{"negative duration", "IDLE_TIMEOUT", "-1s", false},
+		{"zero duration", "JWT_EXPIRY", "0s", false},
+		{"zero shutdown delay", "SHUTDOWN_DELAY", "0", true},
+		{"negative shutdown delay", "SHUTDOWN_DELAY", "-5s", false},
+		{"origins", "CORS_ORIGINS", "https://app.example.com, https://*.example.org,", true},
+		{"origin with a path", "CORS_ORIGINS", "https://app.example.com/ui", false},
+		{"origin without a scheme", "CORS_ORIGINS", "https://app.example.com,app.example.org", false},
+		{"networks", "LOCKOUT_TRUSTED_NETWORKS", "10.0.0.0/8, 192.0.2.1, ::1", true},
+		{"bad network", "LOCKOUT_TRUSTED_NETWORKS", "10.0.0.0/8,intranet", false},
+		{"rate limit", "RATE_LIMIT_AUTH", "5/1s", true},
+		{"rate limit under a millisecond", "RATE_LIMIT_AUTH", "5/1us", false},
+		{"redis over TLS", "REDIS_URL", "rediss://cache:6380/1", true},
+		{"redis scheme", "REDIS_URL", "http://cache:6379", false},
+		{"size", "IDEMPOTENCY_MAX_BYTES", "1024", true},
+		{"zero size", "IDEMPOTENCY_MAX_BYTES", "0", false},
+		{"bool", "CORS_CREDENTIALS", "yes", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parse(values(tt.key, tt.val))
+			if tt.ok && err != nil {
+				t.Errorf("%s=%q: %v", tt.key, tt.val, err)
+			}
+			if !tt.ok && (err == nil || !hasProblem(problemsOf(t, err), tt.key)) {
+				t.Errorf("%s=%q: problems = %v, want one for %s", tt.key, tt.val, err, tt.key)
+			}
+		})
+	}
+}
+
+func TestParseLists(t *testing.T) {
+	c, err := parse(values(
+		"CORS_ORIGINS", " https://app.example.com ,, https://*.example.org",
+		"CORS_METHODS", "get,post",
+		"LOCKOUT_TRUSTED_NETWORKS", "10.1.2.3/8, 192.0.2.1",
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"https://app.example.com", "https://*.example.org"}; !slices.Equal(c.CORS.Origins, want) {
+		t.Errorf("origins = %q, want %q", c.CORS.Origins, want)
+	}
+	if want := []string{"GET", "POST"}; !slices.Equal(c.CORS.Methods, want) {
+		t.Errorf("methods = %q, want %q", c.CORS.Methods, want)
+	}
+	want := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.0.2.1/32")}
+	if !slices.Equal(c.Lockout.Trusted, want) {
+		t.Errorf("trusted = %v, want %v", c.Lockout.Trusted, want)
+	}
+}
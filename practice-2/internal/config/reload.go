@@ -0,0 +1,39 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// WatchReload re-reads the configuration on every SIGHUP and passes it to
+// apply. apply should only pick up settings that are safe to change at
+// runtime, such as the log level; a reload that fails validation is logged
+// and the running configuration is kept. The returned func stops watching.
+func WatchReload(args []string, apply func(*Config)) (stop func()) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-sig:
+				cfg, err := Load(args)
+				if err != nil {
+					slog.Error("config reload failed, keeping current settings", "err", err)
+					continue
+				}
+				apply(cfg)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sig)
+		close(done)
+	}
+}
@@ -0,0 +1,100 @@
+// Package expiring provides the map behind the in-memory stores that keep
+// entries for a limited time: rate limit buckets, lockout subjects, request
+// nonces and idempotent responses.
+package expiring
+
+import (
+	"iter"
+	"time"
+)
+
+// sweepEvery is how often Set sweeps
+const sweepEvery = time.Minute
+
+type item[V any] struct {
+	val     V
+	expires time.Time
+}
+
+// Map holds entries until their expiry time. Expired entries are invisible
+// at once and are dropped by a sweep that Set runs at most once a minute,
+// so a store only pays for the scan while it grows.
+//
+// A Map is not safe for concurrent use; stores guard it with the same lock
+// that makes their read-modify-write steps atomic. Times are passed in so
+// stores can use their own clock.
+type Map[K comparable, V any] struct {
+	items     map[K]item[V]
+	onDrop    func(K, V)
+	lastSweep time.Time
+}
+
+// New returns an empty map. onDrop, if not nil, is called with every entry
+// that leaves the map, whether it expired, was replaced or was deleted.
+func New[K comparable, V any](onDrop func(K, V)) *Map[K, V] {
+	return &Map[K, V]{items: make(map[K]item[V]), onDrop: onDrop}
+}
+
+// Get returns the value for key unless it is missing or expired at now
+func (m *Map[K, V]) Get(key K, now time.Time) (V, bool) {
+	it, ok := m.items[key]
+	if !ok || !now.Before(it.expires) {
+		var zero V
+		return zero, false
+	}
+	return it.val, true
+}
+
+// Set stores val under key until expires
+func (m *Map[K, V]) Set(key K, val V, expires, now time.Time) {
+	if now.Sub(m.lastSweep) >= sweepEvery {
+		m.Sweep(now)
+	}
+	if old, ok := m.items[key]; ok {
+		m.drop(key, old.val)
+	}
+	m.items[key] = item[V]{val: val, expires: expires}
+}
+
+// Delete removes key
+func (m *Map[K, V]) Delete(key K) {
+	if old, ok := m.items[key]; ok {
+		delete(m.items, key)
+		m.drop(key, old.val)
+	}
+}
+
+// All yields the entries that haven't expired at now, with their expiry.
+// Entries may be deleted while iterating.
+func (m *Map[K, V]) All(now time.Time) iter.Seq2[K, time.Time] {
+	return func(yield func(K, time.Time) bool) {
+		for k, it := range m.items {
+			if now.Before(it.expires) && !yield(k, it.expires) {
+				return
+			}
+		}
+	}
+}
+
+// Len returns the number of entries, including expired ones not yet swept
+func (m *Map[K, V]) Len() int {
+	return len(m.items)
+}
+
+// Sweep drops the entries expired at now without waiting for the next
+// sweep Set would run
+func (m *Map[K, V]) Sweep(now time.Time) {
+	m.lastSweep = now
+	for k, it := range m.items {
+		if !now.Before(it.expires) {
+			delete(m.items, k)
+			m.drop(k, it.val)
+		}
+	}
+}
+
+func (m *Map[K, V]) drop(key K, val V) {
+	if m.onDrop != nil {
+		m.onDrop(key, val)
+	}
+}
@@ -0,0 +1,69 @@
+package expiring
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMapExpiry(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	m := New[string, int](nil)
+	m.Set("a", 1, now.Add(time.Second), now)
+
+	if v, ok := m.Get("a", now); !ok || v != 1 {
+		t.Fatalf("Get before expiry = %d, %v; want 1, true", v, ok)
+	}
+	if _, ok := m.Get("a", now.Add(time.Second)); ok {
+		t.Error("Get at expiry found the entry")
+	}
+	if m.Len() != 1 {
+		t.Errorf("Len = %d before a sweep, want 1", m.Len())
+	}
+}
+
+func TestMapSweepsOnSet(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	var dropped []string
+	m := New(func(k string, _ int) { dropped = append(dropped, k) })
+
+	m.Set("short", 1, now.Add(time.Second), now)
+	m.Set("long", 2, now.Add(time.Hour), now)
+
+	// within a minute of the last sweep nothing is scanned
+	m.Set("other", 3, now.Add(time.Hour), now.Add(30*time.Second))
+	if m.Len() != 3 {
+		t.Fatalf("Len = %d, want 3 before the next sweep", m.Len())
+	}
+
+	m.Set("other", 4, now.Add(time.Hour), now.Add(2*time.Minute))
+	if m.Len() != 2 {
+		t.Errorf("Len = %d after the sweep, want 2", m.Len())
+	}
+	want := []string{"short", "other"}
+	if len(dropped) != 2 || dropped[0] != want[0] || dropped[1] != want[1] {
+		t.Errorf("dropped = %v, want %v (expired, then replaced)", dropped, want)
+	}
+}
+
+func TestMapDeleteAndAll(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	drops := 0
+	m := New(func(string, int) { drops++ })
+	m.Set("a", 1, now.Add(time.Minute), now)
+	m.Set("b", 2, now.Add(time.Hour), now)
+	m.Set("c", 3, now.Add(time.Second), now)
+
+	m.Delete("a")
+	m.Delete("missing")
+	if drops != 1 {
+		t.Errorf("onDrop called %d times, want 1", drops)
+	}
+
+	var live []string
+	for k := range m.All(now.Add(2 * time.Second)) {
+		live = append(live, k)
+	}
+	if len(live) != 1 || live[0] != "b" {
+		t.Errorf("All = %v, want [b]", live)
+	}
+}
@@ -0,0 +1,131 @@
+// Package grpcauth authenticates gRPC calls with the same API keys as the
+// HTTP API. The key is sent in the x-api-key metadata and the identity it
+// resolves to is stored with middleware.ContextWithIdentity, together with
+// the key's tenant scope, so handlers and the user repository see the same
+// caller for both transports.
+package grpcauth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"tiny-http/internal/apikey"
+	"tiny-http/internal/middleware"
+	"tiny-http/internal/tracing"
+)
+
+// MetadataKey carries the API key secret; gRPC metadata keys are lower case
+const MetadataKey = "x-api-key"
+
+// Policy says what each method needs. Scopes maps full method names
+// ("/users.v1.UserService/GetUser") to the scope they require. Services in
+// Public, such as health checking and reflection, are open without a key.
+// Any other method is refused, so a method added to a service without a
+// scope here fails closed.
+type Policy struct {
+	Scopes map[string]string
+	Public []string
+}
+
+// public reports whether fullMethod belongs to one of the public services
+func (p Policy) public(fullMethod string) bool {
+	service, _, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	return slices.Contains(p.Public, service)
+}
+
+// Authenticator checks API keys against a key store
+type Authenticator struct {
+	keys   apikey.Store
+	policy Policy
+}
+
+// New returns an Authenticator for keys enforcing policy
+func New(keys apikey.Store, policy Policy) *Authenticator {
+	return &Authenticator{keys: keys, policy: policy}
+}
+
+// Unary returns the interceptor for unary calls
+func (a *Authenticator) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := a.authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Stream returns the interceptor for streaming calls
+func (a *Authenticator) Stream() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticate resolves the key in ctx's metadata and checks it holds the
+// scope fullMethod needs, returning ctx with the caller's identity
+func (a *Authenticator) authenticate(ctx context.Context, fullMethod string) (context.Context, error) {
+	if a.policy.public(fullMethod) {
+		return ctx, nil
+	}
+	scope, ok := a.policy.Scopes[fullMethod]
+	if !ok {
+		return nil, status.Error(codes.PermissionDenied, "method is not open to api keys")
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	secrets := md.Get(MetadataKey)
+	if len(secrets) == 0 || secrets[0] == "" {
+		return nil, status.Error(codes.Unauthenticated, "missing "+MetadataKey+" metadata")
+	}
+
+	lookupCtx, span := tracing.Start(ctx, "auth "+middleware.MethodAPIKey, tracing.KindInternal)
+	span.SetAttr("auth.method", middleware.MethodAPIKey)
+	key, err := a.keys.Lookup(lookupCtx, secrets[0])
+	if err != nil {
+		span.SetAttr("auth.error", err.Error())
+	}
+	span.End()
+	switch {
+	case errors.Is(err, apikey.ErrUnknownKey):
+		return nil, status.Error(codes.Unauthenticated, "invalid api key")
+	case errors.Is(err, apikey.ErrExpired):
+		return nil, status.Error(codes.Unauthenticated, "api key expired")
+	case err != nil:
+		slog.ErrorContext(ctx, "api key lookup", "method", fullMethod, "err", err)
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	if !key.HasScope(scope) {
+		return nil, status.Error(codes.PermissionDenied, "insufficient scope")
+	}
+	return middleware.ContextWithIdentity(ctx, middleware.Identity{
+		ID:     key.ID,
+		Name:   key.Name,
+		Tenant: key.Tenant,
+		Scopes: key.Scopes,
+		Method: middleware.MethodAPIKey,
+	}), nil
+}
+
+// contextStream replaces the context of a server stream
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
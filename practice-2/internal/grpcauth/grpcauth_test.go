@@ -0,0 +1,126 @@
+package grpcauth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"tiny-http/internal/apikey"
+	"tiny-http/internal/middleware"
+)
+
+const (
+	getUser    = "/users.v1.UserService/GetUser"
+	createUser = "/users.v1.UserService/CreateUser"
+	// purgeUsers stands for a method added to the service without a scope
+	purgeUsers = "/users.v1.UserService/PurgeUsers"
+	healthy    = "/grpc.health.v1.Health/Check"
+)
+
+func newAuthenticator() *Authenticator {
+	keys := apikey.NewMemoryStore(
+		apikey.Key{ID: "reader", Tenant: "team-a", Hash: apikey.HashSecret("read-secret"), Scopes: []string{apikey.ScopeUsersRead}},
+		apikey.Key{ID: "admin", Hash: apikey.HashSecret("admin-secret"),
+			Scopes: []string{apikey.ScopeUsersRead, apikey.ScopeUsersWrite, apikey.ScopeTenantsAdmin}},
+		apikey.Key{ID: "old", Hash: apikey.HashSecret("old-secret"), Scopes: []string{apikey.ScopeUsersRead},
+			ExpiresAt: time.Now().Add(-time.Hour)},
+	)
+	return New(keys, Policy{
+		Scopes: map[string]string{getUser: apikey.ScopeUsersRead, createUser: apikey.ScopeUsersWrite},
+		Public: []string{"grpc.health.v1.Health"},
+	})
+}
+
+// call runs method through the unary interceptor with secret as the key,
+// returning the identity the handler saw
+func call(a *Authenticator, method, secret string) (middleware.Identity, bool, error) {
+	ctx := context.Background()
+	if secret != "" {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(MetadataKey, secret))
+	}
+	var (
+		id  middleware.Identity
+		ran bool
+	)
+	_, err := a.Unary()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req any) (any, error) {
+		ran = true
+		id, _ = middleware.IdentityFromContext(ctx)
+		return nil, nil
+	})
+	return id, ran, err
+}
+
+func TestUnary(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		secret string
+		want   codes.Code
+	}{
+		{"read scope", getUser, "read-secret", codes.OK},
+		{"write without its scope", createUser, "read-secret", codes.PermissionDenied},
+		{"write scope", createUser, "admin-secret", codes.OK},
+		{"unmapped method", purgeUsers, "admin-secret", codes.PermissionDenied},
+		{"unmapped method without a key", purgeUsers, "", codes.PermissionDenied},
+		{"unknown service", "/admin.v1.Admin/Shutdown", "admin-secret", codes.PermissionDenied},
+		{"public service", healthy, "", codes.OK},
+		{"no key", getUser, "", codes.Unauthenticated},
+		{"unknown key", getUser, "guess", codes.Unauthenticated},
+		{"expired key", getUser, "old-secret", codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ran, err := call(newAuthenticator(), tt.method, tt.secret)
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("code = %v, want %v (%v)", got, tt.want, err)
+			}
+			if ran != (tt.want == codes.OK) {
+				t.Errorf("handler ran = %v with code %v", ran, status.Code(err))
+			}
+		})
+	}
+}
+
+func TestUnaryIdentity(t *testing.T) {
+	id, _, err := call(newAuthenticator(), getUser, "read-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.ID != "reader" || id.Tenant != "team-a" || id.Method != middleware.MethodAPIKey || !id.HasScope(apikey.ScopeUsersRead) {
+		t.Errorf("identity = %+v", id)
+	}
+}
+
+type fakeStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s fakeStream) Context() context.Context { return s.ctx }
+
+func TestStream(t *testing.T) {
+	a := newAuthenticator()
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(MetadataKey, "read-secret"))
+
+	var id middleware.Identity
+	err := a.Stream()(nil, fakeStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: getUser}, func(srv any, ss grpc.ServerStream) error {
+		id, _ = middleware.IdentityFromContext(ss.Context())
+		return nil
+	})
+	if err != nil || id.ID != "reader" {
+		t.Errorf("stream: identity %+v, error %v", id, err)
+	}
+
+	err = a.Stream()(nil, fakeStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: purgeUsers}, func(srv any, ss grpc.ServerStream) error {
+		t.Error("unmapped stream method ran")
+		return nil
+	})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("unmapped stream method: code = %v, want PermissionDenied", status.Code(err))
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !(linux || darwin)
+
+package health
+
+import "context"
+
+// DiskSpace is not implemented on this platform and always passes
+func DiskSpace(path string, minFree uint64) Check {
+	return func(ctx context.Context) error { return nil }
+}
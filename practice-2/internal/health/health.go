@@ -0,0 +1,167 @@
+// Package health serves liveness and readiness probes. Readiness runs the
+// registered dependency checks in parallel, each under a timeout, and caches
+// the outcome briefly so frequent probes don't hammer the dependencies.
+// Responses only say which checks failed; the errors, which can name hosts
+// and users, are logged instead.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check reports whether a dependency is usable
+type Check func(ctx context.Context) error
+
+// Pinger is implemented by dependencies that can check their own connection
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Status values used in responses
+const (
+	StatusOK       = "ok"
+	StatusFail     = "fail"
+	StatusDraining = "shutting_down"
+)
+
+// Result is the outcome of one check
+type Result struct {
+	Status   string  `json:"status"`
+	Duration float64 `json:"duration_ms"`
+}
+
+// Report is the readiness response body
+type Report struct {
+	Status    string            `json:"status"`
+	CheckedAt time.Time         `json:"checked_at"`
+	Checks    map[string]Result `json:"checks"`
+}
+
+// Health holds the readiness checks and the shutdown state
+type Health struct {
+	timeout time.Duration
+	ttl     time.Duration
+
+	checks   map[string]Check
+	draining atomic.Bool
+
+	mu     sync.Mutex // held while checks run so probes share one run
+	cached Report
+}
+
+// New returns a Health that gives each check timeout to finish and reuses
+// results for ttl
+func New(timeout, ttl time.Duration) *Health {
+	return &Health{timeout: timeout, ttl: ttl, checks: map[string]Check{}}
+}
+
+// Add registers a readiness check under name. It must be called before the
+// handlers serve requests.
+func (h *Health) Add(name string, check Check) {
+	h.checks[name] = check
+}
+
+// Drain marks the server as shutting down; readiness fails from then on
+func (h *Health) Drain() {
+	h.draining.Store(true)
+}
+
+// Ready runs the checks, or returns the cached report if it is fresh
+func (h *Health) Ready(ctx context.Context) Report {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.cached.CheckedAt.IsZero() && time.Since(h.cached.CheckedAt) < h.ttl {
+		return h.cached
+	}
+
+	report := Report{Status: StatusOK, CheckedAt: time.Now(), Checks: make(map[string]Result, len(h.checks))}
+	var (
+		wg  sync.WaitGroup
+		rmu sync.Mutex
+	)
+	for name, check := range h.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := h.run(ctx, name, check)
+			rmu.Lock()
+			report.Checks[name] = res
+			if res.Status != StatusOK {
+				report.Status = StatusFail
+			}
+			rmu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	h.cached = report
+	return report
+}
+
+// run executes the check registered as name under the timeout, logging why
+// it failed. A check that ignores its context still counts as failed once
+// the timeout passes.
+func (h *Health) run(ctx context.Context, name string, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	res := Result{Status: StatusOK, Duration: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		res.Status = StatusFail
+		slog.WarnContext(ctx, "readiness check failed", "check", name, "err", err)
+	}
+	return res
+}
+
+// LiveHandler answers 200 as long as the process can serve HTTP
+func (h *Health) LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		write(w, http.StatusOK, map[string]string{"status": StatusOK})
+	})
+}
+
+// ReadyHandler answers 200 with the check breakdown when every check
+// passes, 503 otherwise or once Drain has been called
+func (h *Health) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.draining.Load() {
+			write(w, http.StatusServiceUnavailable, Report{
+				Status:    StatusDraining,
+				CheckedAt: time.Now(),
+				Checks:    map[string]Result{},
+			})
+			return
+		}
+
+		report := h.Ready(r.Context())
+		status := http.StatusOK
+		if report.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+		write(w, status, report)
+	})
+}
+
+func write(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,109 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// captureLog sends the default logger to a buffer for the rest of the test
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func probe(h http.Handler) (*httptest.ResponseRecorder, Report) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var report Report
+	json.Unmarshal(rec.Body.Bytes(), &report)
+	return rec, report
+}
+
+func TestReadyHidesErrors(t *testing.T) {
+	logs := captureLog(t)
+	const secret = `dial tcp db.internal:5432: password authentication failed for user "api"`
+	h := New(time.Second, 0)
+	h.Add("db", func(ctx context.Context) error { return errors.New(secret) })
+	h.Add("cache", func(ctx context.Context) error { return nil })
+
+	rec, report := probe(h.ReadyHandler())
+	if rec.Code != http.StatusServiceUnavailable || report.Status != StatusFail {
+		t.Errorf("status = %d %q, want 503 fail", rec.Code, report.Status)
+	}
+	if report.Checks["db"].Status != StatusFail || report.Checks["cache"].Status != StatusOK {
+		t.Errorf("checks = %+v", report.Checks)
+	}
+	if strings.Contains(rec.Body.String(), "db.internal") || strings.Contains(rec.Body.String(), "password") {
+		t.Errorf("response leaks the error: %s", rec.Body)
+	}
+	if !strings.Contains(logs.String(), "check=db") || !strings.Contains(logs.String(), "db.internal:5432") {
+		t.Errorf("error not logged: %s", logs)
+	}
+}
+
+func TestReadyOK(t *testing.T) {
+	h := New(time.Second, 0)
+	h.Add("db", func(ctx context.Context) error { return nil })
+
+	rec, report := probe(h.ReadyHandler())
+	if rec.Code != http.StatusOK || report.Status != StatusOK || report.Checks["db"].Status != StatusOK {
+		t.Errorf("status = %d, report %+v", rec.Code, report)
+	}
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Error("readiness response may be cached")
+	}
+}
+
+func TestReadyTimeout(t *testing.T) {
+	captureLog(t)
+	h := New(10*time.Millisecond, 0)
+	release := make(chan struct{})
+	defer close(release)
+	h.Add("stuck", func(ctx context.Context) error {
+		<-release // ignores ctx
+		return nil
+	})
+
+	if report := h.Ready(context.Background()); report.Checks["stuck"].Status != StatusFail {
+		t.Errorf("check past its timeout: %+v", report.Checks["stuck"])
+	}
+}
+
+func TestReadyCaches(t *testing.T) {
+	var runs atomic.Int32
+	h := New(time.Second, time.Hour)
+	h.Add("db", func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	})
+	for range 3 {
+		h.Ready(context.Background())
+	}
+	if runs.Load() != 1 {
+		t.Errorf("check ran %d times within the ttl, want once", runs.Load())
+	}
+}
+
+func TestReadyDraining(t *testing.T) {
+	h := New(time.Second, 0)
+	h.Drain()
+	rec, report := probe(h.ReadyHandler())
+	if rec.Code != http.StatusServiceUnavailable || report.Status != StatusDraining {
+		t.Errorf("draining: status = %d %q", rec.Code, report.Status)
+	}
+	if rec, _ := probe(h.LiveHandler()); rec.Code != http.StatusOK {
+		t.Errorf("liveness while draining: %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,205 @@
+// Package hmacauth verifies requests signed with the scheme implemented by
+// the signing package: the signature must match the key's shared secret, the
+// timestamp must be within the allowed clock skew and the nonce must not
+// have been used before.
+package hmacauth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"tiny-http/signing"
+)
+
+var (
+	// ErrMissing is returned when any of the signature headers is absent
+	ErrMissing = errors.New("missing signature headers")
+	// ErrMalformed is returned for an unparsable timestamp or bad nonce
+	ErrMalformed = errors.New("malformed signature headers")
+	// ErrUnknownKey is returned when no signing key has the given id
+	ErrUnknownKey = errors.New("unknown signing key")
+	// ErrExpired is returned when the signing key is past its expiry
+	ErrExpired = errors.New("signing key expired")
+	// ErrSkew is returned for timestamps too far from the server clock
+	ErrSkew = errors.New("timestamp outside the allowed clock skew")
+	// ErrSignature is returned when the signature does not match
+	ErrSignature = errors.New("signature mismatch")
+	// ErrReplay is returned for a nonce that was already used
+	ErrReplay = errors.New("nonce already used")
+	// ErrBodySize is returned for bodies too large to hash
+	ErrBodySize = errors.New("body too large to verify")
+)
+
+// maxBody is the largest body the verifier hashes, matching the JSON
+// decoder's limit
+const maxBody = 1 << 20
+
+// Key is a shared signing secret. Unlike API keys the secret itself has to
+// be kept, since the server recomputes the signature. Tenant works as for
+// API keys.
+type Key struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Secret    string    `json:"secret"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+// Store finds signing keys by id
+type Store interface {
+	Key(ctx context.Context, id string) (Key, error)
+}
+
+// MemoryStore keeps signing keys in a map
+type MemoryStore struct {
+	byID map[string]Key
+}
+
+// NewMemoryStore returns a store holding keys
+func NewMemoryStore(keys ...Key) *MemoryStore {
+	s := &MemoryStore{byID: make(map[string]Key, len(keys))}
+	for _, k := range keys {
+		s.byID[k.ID] = k
+	}
+	return s
+}
+
+// LoadFile reads a JSON array of keys from path, e.g.
+//
+//	[{"id": "billing", "name": "billing service", "tenant": "billing",
+//	  "secret": "<random>", "scopes": ["users:read"]}]
+func LoadFile(path string) (*MemoryStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read signing key file: %w", err)
+	}
+	var keys []Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("parse signing key file %s: %w", path, err)
+	}
+	for i, k := range keys {
+		if k.ID == "" || len(k.Secret) < 32 {
+			return nil, fmt.Errorf("parse signing key file %s: entry %d needs an id and a secret of at least 32 characters", path, i)
+		}
+	}
+	return NewMemoryStore(keys...), nil
+}
+
+func (s *MemoryStore) Key(ctx context.Context, id string) (Key, error) {
+	k, ok := s.byID[id]
+	if !ok {
+		return Key{}, ErrUnknownKey
+	}
+	return k, nil
+}
+
+// Verifier checks signed requests
+type Verifier struct {
+	keys   Store
+	nonces NonceStore
+	skew   time.Duration
+	now    func() time.Time
+}
+
+// NewVerifier accepts timestamps up to skew away from the server clock.
+// Nonces are remembered for twice the skew, after which their timestamp is
+// rejected anyway.
+func NewVerifier(keys Store, nonces NonceStore, skew time.Duration) *Verifier {
+	return &Verifier{keys: keys, nonces: nonces, skew: skew, now: time.Now}
+}
+
+// EncodedBody is a request body that was sent with a Content-Encoding and
+// reads decoded. The signature covers the body as sent, so Verify hashes
+// Encoded and leaves the decoded body for the handler.
+type EncodedBody struct {
+	io.ReadCloser
+	Encoded []byte
+}
+
+// Signed reports whether r carries a signature
+func Signed(r *http.Request) bool {
+	return r.Header.Get(signing.HeaderSignature) != ""
+}
+
+// Verify checks r's signature and returns the signing key. The body is read
+// and replaced so handlers can still decode it; an EncodedBody is hashed as
+// it was sent. The nonce is only recorded
+// once the signature is valid, so forged requests can't burn nonces.
+func (v *Verifier) Verify(ctx context.Context, r *http.Request) (Key, error) {
+	h := r.Header
+	id, ts, nonce, sig := h.Get(signing.HeaderKeyID), h.Get(signing.HeaderTimestamp),
+		h.Get(signing.HeaderNonce), h.Get(signing.HeaderSignature)
+	if id == "" || ts == "" || nonce == "" || sig == "" {
+		return Key{}, ErrMissing
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(nonce) < 16 || len(nonce) > 128 {
+		return Key{}, ErrMalformed
+	}
+
+	key, err := v.keys.Key(ctx, id)
+	if err != nil {
+		return Key{}, err
+	}
+	now := v.now()
+	if !key.ExpiresAt.IsZero() && now.After(key.ExpiresAt) {
+		return Key{}, ErrExpired
+	}
+	if d := now.Sub(time.Unix(unix, 0)); d > v.skew || d < -v.skew {
+		return Key{}, ErrSkew
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		return Key{}, err
+	}
+
+	canonical := signing.Canonical(r.Method, r.URL.EscapedPath(), r.URL.Query(), ts, nonce, signing.BodyHash(body))
+	want := signing.Compute([]byte(key.Secret), canonical)
+	if !hmac.Equal([]byte(want), []byte(sig)) {
+		return Key{}, ErrSignature
+	}
+
+	fresh, err := v.nonces.Use(ctx, key.ID+":"+nonce, 2*v.skew)
+	if err != nil {
+		return Key{}, fmt.Errorf("record nonce: %w", err)
+	}
+	if !fresh {
+		return Key{}, ErrReplay
+	}
+	return key, nil
+}
+
+// readBody returns the body the signature covers, replacing r.Body with an
+// identical reader if it had to be read
+func readBody(r *http.Request) ([]byte, error) {
+	if eb, ok := r.Body.(*EncodedBody); ok {
+		if len(eb.Encoded) > maxBody {
+			return nil, ErrBodySize
+		}
+		return eb.Encoded, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBody+1))
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		return nil, ErrBodySize
+	case err != nil:
+		return nil, fmt.Errorf("read body: %w", err)
+	case len(body) > maxBody:
+		return nil, ErrBodySize
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
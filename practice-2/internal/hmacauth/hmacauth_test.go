@@ -0,0 +1,161 @@
+package hmacauth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tiny-http/signing"
+)
+
+const secret = "0123456789abcdef0123456789abcdef"
+
+var now = time.Unix(1_700_000_000, 0)
+
+func newVerifier() *Verifier {
+	keys := NewMemoryStore(
+		Key{ID: "billing", Secret: secret, Scopes: []string{"users:read"}},
+		Key{ID: "old", Secret: secret, ExpiresAt: now.Add(-time.Hour)},
+	)
+	v := NewVerifier(keys, NewMemoryNonces(), 5*time.Minute)
+	v.now = func() time.Time { return now }
+	return v
+}
+
+// signed returns a request signed by keyID at the given time
+func signed(t *testing.T, keyID, target, body string, at time.Time) *http.Request {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	s := &signing.Signer{KeyID: keyID, Secret: []byte(secret), Now: func() time.Time { return at }}
+	if err := s.Sign(r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestVerifyRoundTrip(t *testing.T) {
+	v := newVerifier()
+	r := signed(t, "billing", "/users?limit=5", `{"name":"Alice"}`, now)
+
+	key, err := v.Verify(context.Background(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.ID != "billing" {
+		t.Errorf("key = %q, want billing", key.ID)
+	}
+	if body, _ := io.ReadAll(r.Body); string(body) != `{"name":"Alice"}` {
+		t.Errorf("body left for the handler = %q", body)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		req  func(t *testing.T) *http.Request
+		want error
+	}{
+		{"unsigned", func(t *testing.T) *http.Request {
+			return httptest.NewRequest(http.MethodGet, "/users", nil)
+		}, ErrMissing},
+		{"timestamp too old", func(t *testing.T) *http.Request {
+			return signed(t, "billing", "/users", "", now.Add(-6*time.Minute))
+		}, ErrSkew},
+		{"timestamp in the future", func(t *testing.T) *http.Request {
+			return signed(t, "billing", "/users", "", now.Add(6*time.Minute))
+		}, ErrSkew},
+		{"unknown key", func(t *testing.T) *http.Request {
+			return signed(t, "nobody", "/users", "", now)
+		}, ErrUnknownKey},
+		{"expired key", func(t *testing.T) *http.Request {
+			return signed(t, "old", "/users", "", now)
+		}, ErrExpired},
+		{"tampered body", func(t *testing.T) *http.Request {
+			r := signed(t, "billing", "/users", `{"name":"Alice"}`, now)
+			r.Body = io.NopCloser(strings.NewReader(`{"name":"Mallory"}`))
+			return r
+		}, ErrSignature},
+		{"tampered query", func(t *testing.T) *http.Request {
+			r := signed(t, "billing", "/users?limit=5", "", now)
+			r.URL.RawQuery = "limit=500"
+			return r
+		}, ErrSignature},
+		{"tampered method", func(t *testing.T) *http.Request {
+			r := signed(t, "billing", "/users", "", now)
+			r.Method = http.MethodDelete
+			return r
+		}, ErrSignature},
+		{"short nonce", func(t *testing.T) *http.Request {
+			r := signed(t, "billing", "/users", "", now)
+			r.Header.Set(signing.HeaderNonce, "abc")
+			return r
+		}, ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newVerifier().Verify(context.Background(), tt.req(t))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Verify error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsReplay(t *testing.T) {
+	v := newVerifier()
+	r := signed(t, "billing", "/users", `{"name":"Alice"}`, now)
+	replay := r.Clone(context.Background())
+	replay.Body, _ = r.GetBody()
+
+	if _, err := v.Verify(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(context.Background(), replay); !errors.Is(err, ErrReplay) {
+		t.Errorf("replayed request: error = %v, want ErrReplay", err)
+	}
+}
+
+// A forged request must not burn the nonce of the genuine one
+func TestVerifyBadSignatureKeepsNonce(t *testing.T) {
+	v := newVerifier()
+	r := signed(t, "billing", "/users", "", now)
+	forged := r.Clone(context.Background())
+	forged.Header.Set(signing.HeaderSignature, strings.Repeat("0", 64))
+
+	if _, err := v.Verify(context.Background(), forged); !errors.Is(err, ErrSignature) {
+		t.Fatalf("forged request: error = %v, want ErrSignature", err)
+	}
+	if _, err := v.Verify(context.Background(), r); err != nil {
+		t.Errorf("genuine request after a forgery: %v", err)
+	}
+}
+
+// Proxies and client libraries may reorder query parameters; the canonical
+// form sorts them so the signature still matches
+func TestVerifyQueryOrder(t *testing.T) {
+	v := newVerifier()
+	r := signed(t, "billing", "/users?offset=10&tag=b&limit=5&tag=a", "", now)
+	r.URL.RawQuery = "limit=5&tag=a&offset=10&tag=b"
+
+	if _, err := v.Verify(context.Background(), r); err != nil {
+		t.Errorf("reordered query: %v", err)
+	}
+}
+
+func TestVerifyEncodedBody(t *testing.T) {
+	v := newVerifier()
+	r := signed(t, "billing", "/users", "compressed bytes", now)
+	r.Body = &EncodedBody{ReadCloser: io.NopCloser(strings.NewReader("decoded bytes")), Encoded: []byte("compressed bytes")}
+
+	if _, err := v.Verify(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(r.Body); string(body) != "decoded bytes" {
+		t.Errorf("body left for the handler = %q, want the decoded one", body)
+	}
+}
@@ -0,0 +1,40 @@
+package hmacauth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"tiny-http/internal/expiring"
+)
+
+// NonceStore remembers nonces for a while
+type NonceStore interface {
+	// Use records nonce for ttl and reports whether it was unused
+	Use(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+}
+
+// MemoryNonces is a NonceStore local to this process. Replays are only
+// caught by the instance that saw the original request.
+type MemoryNonces struct {
+	mu   sync.Mutex
+	seen *expiring.Map[string, struct{}]
+	now  func() time.Time
+}
+
+// NewMemoryNonces returns an empty nonce store
+func NewMemoryNonces() *MemoryNonces {
+	return &MemoryNonces{seen: expiring.New[string, struct{}](nil), now: time.Now}
+}
+
+func (m *MemoryNonces) Use(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if _, ok := m.seen.Get(nonce, now); ok {
+		return false, nil
+	}
+	m.seen.Set(nonce, struct{}{}, now.Add(ttl), now)
+	return true, nil
+}
@@ -0,0 +1,38 @@
+// Package idempotency stores the first response to each Idempotency-Key so
+// retried requests can be answered without running the handler again.
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+var (
+	// ErrInFlight means the first request with the key hasn't finished
+	ErrInFlight = errors.New("idempotency: request in progress")
+	// ErrMismatch means the key was first used for a different request
+	ErrMismatch = errors.New("idempotency: key reused with a different request")
+)
+
+// Response is a stored response
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Store reserves keys and keeps responses until they expire
+type Store interface {
+	// Begin reserves key for a request with fingerprint. It returns the
+	// stored response if the key already completed with the same
+	// fingerprint, nil if the caller now owns the key, ErrInFlight if
+	// another request holds it and ErrMismatch if the fingerprints differ.
+	Begin(ctx context.Context, key, fingerprint string, ttl time.Duration) (*Response, error)
+	// Complete stores resp for a key reserved by Begin
+	Complete(ctx context.Context, key string, resp Response) error
+	// Release drops a reservation without storing a response, so the
+	// request can be retried
+	Release(ctx context.Context, key string) error
+}
@@ -0,0 +1,123 @@
+package idempotency
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"tiny-http/internal/expiring"
+)
+
+// entry is a reserved or completed key
+type entry struct {
+	fingerprint string
+	resp        *Response // nil while in flight
+	size        int64     // bytes of resp counted against maxBytes
+}
+
+// Memory is a Store local to this process. Stored responses share a budget
+// of maxBytes; when a new one doesn't fit, the responses closest to expiry
+// are dropped first, so their keys act as fresh ones on a retry.
+type Memory struct {
+	mu       sync.Mutex
+	entries  *expiring.Map[string, *entry]
+	now      func() time.Time
+	maxBytes int64
+	bytes    int64
+}
+
+// NewMemory returns an empty in-memory store keeping at most maxBytes of
+// responses
+func NewMemory(maxBytes int64) *Memory {
+	m := &Memory{now: time.Now, maxBytes: maxBytes}
+	m.entries = expiring.New(func(_ string, e *entry) { m.bytes -= e.size })
+	return m
+}
+
+func (m *Memory) Begin(ctx context.Context, key, fingerprint string, ttl time.Duration) (*Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	e, ok := m.entries.Get(key, now)
+	if !ok {
+		m.entries.Set(key, &entry{fingerprint: fingerprint}, now.Add(ttl), now)
+		return nil, nil
+	}
+	switch {
+	case e.fingerprint != fingerprint:
+		return nil, ErrMismatch
+	case e.resp == nil:
+		return nil, ErrInFlight
+	}
+	return e.resp, nil
+}
+
+// Complete stores resp unless it is bigger than the whole budget, in which
+// case the key is released and a retry runs the handler again
+func (m *Memory) Complete(ctx context.Context, key string, resp Response) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	e, ok := m.entries.Get(key, now)
+	if !ok {
+		return nil
+	}
+	size := responseSize(resp)
+	if size > m.maxBytes {
+		m.entries.Delete(key)
+		return nil
+	}
+	m.makeRoom(size, now)
+	e.resp, e.size = &resp, size
+	m.bytes += size
+	return nil
+}
+
+func (m *Memory) Release(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries.Delete(key)
+	return nil
+}
+
+// makeRoom drops expired entries and then the stored responses closest to
+// expiry until size more bytes fit in the budget
+func (m *Memory) makeRoom(size int64, now time.Time) {
+	if m.bytes+size <= m.maxBytes {
+		return
+	}
+	m.entries.Sweep(now)
+
+	type stored struct {
+		key     string
+		expires time.Time
+	}
+	var oldest []stored
+	for k, exp := range m.entries.All(now) {
+		if e, _ := m.entries.Get(k, now); e.resp != nil {
+			oldest = append(oldest, stored{k, exp})
+		}
+	}
+	slices.SortFunc(oldest, func(a, b stored) int { return a.expires.Compare(b.expires) })
+	for _, s := range oldest {
+		if m.bytes+size <= m.maxBytes {
+			return
+		}
+		m.entries.Delete(s.key)
+	}
+}
+
+// responseSize approximates the memory a stored response takes
+func responseSize(resp Response) int64 {
+	n := int64(len(resp.Body))
+	for k, vs := range resp.Header {
+		n += int64(len(k))
+		for _, v := range vs {
+			n += int64(len(v))
+		}
+	}
+	return n
+}
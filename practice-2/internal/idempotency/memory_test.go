@@ -0,0 +1,80 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryReplay(t *testing.T) {
+	m := NewMemory(1 << 20)
+	ctx := context.Background()
+
+	if resp, err := m.Begin(ctx, "k", "fp", time.Hour); resp != nil || err != nil {
+		t.Fatalf("first Begin = %v, %v; want nil, nil", resp, err)
+	}
+	if _, err := m.Begin(ctx, "k", "fp", time.Hour); !errors.Is(err, ErrInFlight) {
+		t.Errorf("Begin while in flight: err = %v, want ErrInFlight", err)
+	}
+	m.Complete(ctx, "k", Response{Status: 201, Body: []byte("created")})
+
+	resp, err := m.Begin(ctx, "k", "fp", time.Hour)
+	if err != nil || resp == nil || resp.Status != 201 {
+		t.Errorf("Begin after Complete = %+v, %v; want the stored 201", resp, err)
+	}
+	if _, err := m.Begin(ctx, "k", "other", time.Hour); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Begin with another fingerprint: err = %v, want ErrMismatch", err)
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	m := NewMemory(100)
+	m.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	store := func(key string, size int) {
+		t.Helper()
+		if _, err := m.Begin(ctx, key, "fp", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		m.Complete(ctx, key, Response{Status: 200, Body: make([]byte, size)})
+		now = now.Add(time.Second)
+	}
+	stored := func(key string) bool {
+		resp, _ := m.Begin(ctx, key, "fp", time.Hour)
+		return resp != nil
+	}
+
+	store("a", 40)
+	store("b", 40)
+	store("c", 40) // evicts a, the oldest
+	if m.bytes != 80 {
+		t.Errorf("bytes = %d, want 80", m.bytes)
+	}
+	if !stored("b") || !stored("c") {
+		t.Error("newer responses were evicted")
+	}
+	if stored("a") {
+		t.Error("oldest response kept over budget")
+	}
+
+	store("big", 101)
+	if stored("big") {
+		t.Error("response larger than the budget was stored")
+	}
+	if m.bytes > 100 {
+		t.Errorf("bytes = %d, over the budget", m.bytes)
+	}
+}
+
+func TestMemoryRelease(t *testing.T) {
+	m := NewMemory(1 << 20)
+	ctx := context.Background()
+	m.Begin(ctx, "k", "fp", time.Hour)
+	m.Release(ctx, "k")
+	if resp, err := m.Begin(ctx, "k", "other", time.Hour); resp != nil || err != nil {
+		t.Errorf("Begin after Release = %v, %v; want a fresh reservation", resp, err)
+	}
+}
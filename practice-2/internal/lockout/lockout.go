@@ -0,0 +1,96 @@
+// Package lockout tracks failed authentication attempts and locks out
+// subjects (client IPs, key prefixes) that keep failing. Each lockout lasts
+// twice as long as the previous one, up to a maximum, until the subject
+// stays quiet for a while.
+package lockout
+
+import (
+	"sync"
+	"time"
+
+	"tiny-http/internal/expiring"
+)
+
+// Policy says when and for how long subjects are locked out
+type Policy struct {
+	// Threshold failures within Window trigger a lockout
+	Threshold int
+	Window    time.Duration
+	// Base is the first lockout; each further one doubles up to Max
+	Base time.Duration
+	Max  time.Duration
+}
+
+// subject is the state for one IP or key prefix
+type subject struct {
+	failures    int
+	firstFail   time.Time
+	level       int // lockouts so far
+	lockedUntil time.Time
+}
+
+// Tracker counts failures in memory
+type Tracker struct {
+	policy Policy
+
+	mu sync.Mutex
+	// subjects expire once they have been quiet long enough for their
+	// backoff level to be forgotten, which is after any lockout has ended
+	subjects *expiring.Map[string, *subject]
+	now      func() time.Time
+}
+
+// NewTracker returns a tracker applying policy
+func NewTracker(policy Policy) *Tracker {
+	return &Tracker{policy: policy, subjects: expiring.New[string, *subject](nil), now: time.Now}
+}
+
+// Locked returns how long key stays locked out, or 0
+func (t *Tracker) Locked(key string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	s, ok := t.subjects.Get(key, now)
+	if !ok {
+		return 0
+	}
+	return max(s.lockedUntil.Sub(now), 0)
+}
+
+// Fail records a failed attempt by key. If it triggers a lockout the
+// lockout's length and the number of failures that led to it are returned.
+func (t *Tracker) Fail(key string) (lockedFor time.Duration, failures int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	s, ok := t.subjects.Get(key, now)
+	if !ok {
+		s = &subject{}
+	}
+	t.subjects.Set(key, s, now.Add(t.policy.Max+t.policy.Window), now)
+	if s.failures == 0 || now.Sub(s.firstFail) > t.policy.Window {
+		s.failures, s.firstFail = 0, now
+	}
+	s.failures++
+	if s.failures < t.policy.Threshold {
+		return 0, s.failures
+	}
+
+	failures = s.failures
+	lockedFor = t.policy.Base << min(s.level, 30)
+	if lockedFor > t.policy.Max || lockedFor <= 0 {
+		lockedFor = t.policy.Max
+	}
+	s.level++
+	s.failures = 0
+	s.lockedUntil = now.Add(lockedFor)
+	return lockedFor, failures
+}
+
+// Succeed clears the failures recorded for key
+func (t *Tracker) Succeed(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.subjects.Delete(key)
+}
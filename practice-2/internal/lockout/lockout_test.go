@@ -0,0 +1,86 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+)
+
+var policy = Policy{Threshold: 3, Window: time.Minute, Base: time.Minute, Max: 5 * time.Minute}
+
+func newTracker() (*Tracker, *time.Time) {
+	now := time.Unix(1_700_000_000, 0)
+	t := NewTracker(policy)
+	t.now = func() time.Time { return now }
+	return t, &now
+}
+
+// failUntilLocked fails key Threshold times and returns the lockout
+func failUntilLocked(t *testing.T, tr *Tracker, key string) time.Duration {
+	t.Helper()
+	for i := 1; i < policy.Threshold; i++ {
+		if d, n := tr.Fail(key); d != 0 || n != i {
+			t.Fatalf("failure %d: locked for %v after %d failures", i, d, n)
+		}
+	}
+	d, n := tr.Fail(key)
+	if n != policy.Threshold {
+		t.Fatalf("lockout after %d failures, want %d", n, policy.Threshold)
+	}
+	return d
+}
+
+func TestBackoffDoubles(t *testing.T) {
+	tr, now := newTracker()
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute} {
+		if got := failUntilLocked(t, tr, "ip:192.0.2.1"); got != want {
+			t.Fatalf("lockout = %v, want %v", got, want)
+		}
+		if got := tr.Locked("ip:192.0.2.1"); got != want {
+			t.Errorf("Locked = %v, want %v", got, want)
+		}
+		*now = now.Add(want)
+		if got := tr.Locked("ip:192.0.2.1"); got != 0 {
+			t.Errorf("still locked for %v after the lockout ended", got)
+		}
+	}
+}
+
+func TestFailuresOutsideWindowDontCount(t *testing.T) {
+	tr, now := newTracker()
+	tr.Fail("ip:192.0.2.1")
+	tr.Fail("ip:192.0.2.1")
+	*now = now.Add(policy.Window + time.Second)
+	if d, n := tr.Fail("ip:192.0.2.1"); d != 0 || n != 1 {
+		t.Errorf("after the window: locked for %v after %d failures, want a fresh count", d, n)
+	}
+}
+
+func TestSucceedResets(t *testing.T) {
+	tr, now := newTracker()
+	failUntilLocked(t, tr, "key:abcdefgh")
+	*now = now.Add(policy.Base)
+	failUntilLocked(t, tr, "key:abcdefgh") // 2m
+	*now = now.Add(2 * policy.Base)
+
+	tr.Succeed("key:abcdefgh")
+	if got := failUntilLocked(t, tr, "key:abcdefgh"); got != policy.Base {
+		t.Errorf("lockout after a success = %v, want the base %v again", got, policy.Base)
+	}
+}
+
+func TestQuietSubjectIsForgotten(t *testing.T) {
+	tr, now := newTracker()
+	failUntilLocked(t, tr, "ip:192.0.2.1")
+	*now = now.Add(policy.Max + policy.Window + time.Second)
+	if got := failUntilLocked(t, tr, "ip:192.0.2.1"); got != policy.Base {
+		t.Errorf("lockout after staying quiet = %v, want the base %v", got, policy.Base)
+	}
+}
+
+func TestSubjectsAreIndependent(t *testing.T) {
+	tr, _ := newTracker()
+	failUntilLocked(t, tr, "ip:192.0.2.1")
+	if got := tr.Locked("ip:192.0.2.2"); got != 0 {
+		t.Errorf("other IP locked for %v", got)
+	}
+}
@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Counter only goes up
+type Counter struct{ v atomicFloat }
+
+// Inc adds one
+func (c *Counter) Inc() { c.v.Add(1) }
+
+// Add adds d, which must not be negative
+func (c *Counter) Add(d float64) {
+	if d < 0 {
+		panic("metrics: counter decreased")
+	}
+	c.v.Add(d)
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct{ vec[Counter] }
+
+// NewCounterVec registers a counter family in r
+func NewCounterVec(r *Registry, name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec[Counter]{name: name, help: help, labels: labels,
+		newValue: func() *Counter { return new(Counter) }, values: map[string]*Counter{}}}
+	r.register(name, c)
+	return c
+}
+
+// With returns the counter for the given label values
+func (c *CounterVec) With(values ...string) *Counter { return c.with(values) }
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.header(w, "counter")
+	c.each(func(labels []string, v *Counter) {
+		fmt.Fprintf(w, "%s %s\n", c.series(c.name, labels), formatFloat(v.v.Load()))
+	})
+}
+
+// Gauge goes up and down
+type Gauge struct{ v atomicFloat }
+
+// Inc adds one
+func (g *Gauge) Inc() { g.v.Add(1) }
+
+// Dec subtracts one
+func (g *Gauge) Dec() { g.v.Add(-1) }
+
+// Set replaces the value
+func (g *Gauge) Set(f float64) { g.v.Set(f) }
+
+// GaugeVec is a gauge partitioned by labels
+type GaugeVec struct{ vec[Gauge] }
+
+// NewGaugeVec registers a gauge family in r
+func NewGaugeVec(r *Registry, name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{vec[Gauge]{name: name, help: help, labels: labels,
+		newValue: func() *Gauge { return new(Gauge) }, values: map[string]*Gauge{}}}
+	r.register(name, g)
+	return g
+}
+
+// With returns the gauge for the given label values
+func (g *GaugeVec) With(values ...string) *Gauge { return g.with(values) }
+
+func (g *GaugeVec) write(w *bufio.Writer) {
+	g.header(w, "gauge")
+	g.each(func(labels []string, v *Gauge) {
+		fmt.Fprintf(w, "%s %s\n", g.series(g.name, labels), formatFloat(v.v.Load()))
+	})
+}
+
+// Histogram counts observations into cumulative buckets
+type Histogram struct {
+	mu     sync.Mutex
+	bounds []float64
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// Observe records one value
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.mu.Lock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+	h.mu.Unlock()
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct{ vec[Histogram] }
+
+// NewHistogramVec registers a histogram family with the given upper bounds
+// (sorted ascending, +Inf is implied) in r
+func NewHistogramVec(r *Registry, name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{vec[Histogram]{name: name, help: help, labels: labels,
+		newValue: func() *Histogram {
+			return &Histogram{bounds: buckets, counts: make([]uint64, len(buckets))}
+		}, values: map[string]*Histogram{}}}
+	r.register(name, h)
+	return h
+}
+
+// With returns the histogram for the given label values
+func (h *HistogramVec) With(values ...string) *Histogram { return h.with(values) }
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.header(w, "histogram")
+	h.each(func(labels []string, v *Histogram) {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		var cum uint64
+		for i, b := range v.bounds {
+			cum += v.counts[i]
+			fmt.Fprintf(w, "%s %d\n", h.series(h.name+"_bucket", labels, "le", formatFloat(b)), cum)
+		}
+		fmt.Fprintf(w, "%s %d\n", h.series(h.name+"_bucket", labels, "le", "+Inf"), v.count)
+		fmt.Fprintf(w, "%s %s\n", h.series(h.name+"_sum", labels), formatFloat(v.sum))
+		fmt.Fprintf(w, "%s %d\n", h.series(h.name+"_count", labels), v.count)
+	})
+}
@@ -1,30 +1,69 @@
 package middleware
 
 import (
-	"encoding/json"
-	"log"
+	"context"
+	"errors"
 	"net/http"
+
+	"tiny-http/internal/apikey"
+	"tiny-http/internal/problem"
 )
 
-// jsonError is a helper for consistent error responses
-func jsonError(w http.ResponseWriter, status int, msg string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+type contextKey int
+
+const (
+	apiKeyContextKey contextKey = iota
+	identityContextKey
+	claimsContextKey
+)
+
+// APIKeyFromContext returns the key resolved by APIKeyMiddleware
+func APIKeyFromContext(ctx context.Context) (apikey.Key, bool) {
+	k, ok := ctx.Value(apiKeyContextKey).(apikey.Key)
+	return k, ok
 }
 
-// APIKeyMiddleware checks X-API-Key and logs each request
-func APIKeyMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("%s %s", r.Method, r.URL.Path)
+// APIKeyMiddleware checks X-API-Key against store, requires the scope the
+// request method needs on resource (see apikey.ScopeFor).
+// The resolved key is available to handlers via APIKeyFromContext and
+// IdentityFromContext, and the key's tenant via tenant.FromContext.
+func APIKeyMiddleware(store apikey.Store, resource string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			secret := r.Header.Get("X-API-Key")
+			if secret == "" {
+				authFailures.With(reasonMissingKey).Inc()
+				problem.Write(w, r, http.StatusUnauthorized, "missing X-API-Key")
+				return
+			}
 
-		apiKey := r.Header.Get("X-API-Key")
-		if apiKey != "secret123" {
-			jsonError(w, http.StatusUnauthorized, "unauthorized")
-			return
-		}
+			ctx, end := traceAuth(r, MethodAPIKey)
+			key, err := store.Lookup(ctx, secret)
+			end(err)
+			switch {
+			case errors.Is(err, apikey.ErrUnknownKey):
+				authFailures.With(reasonInvalidKey).Inc()
+				problem.Write(w, r, http.StatusUnauthorized, "invalid api key")
+				return
+			case errors.Is(err, apikey.ErrExpired):
+				authFailures.With(reasonExpiredKey).Inc()
+				problem.Write(w, r, http.StatusUnauthorized, "api key expired")
+				return
+			case err != nil:
+				authFailures.With(reasonLookupError).Inc()
+				logError(r, "api key lookup", err)
+				problem.Write(w, r, http.StatusInternalServerError, "internal error")
+				return
+			}
 
-		next.ServeHTTP(w, r)
-	})
+			ctx = context.WithValue(r.Context(), apiKeyContextKey, key)
+			authorize(w, r.WithContext(ctx), next, Identity{
+				ID:     key.ID,
+				Name:   key.Name,
+				Tenant: key.Tenant,
+				Scopes: key.Scopes,
+				Method: MethodAPIKey,
+			}, apikey.ScopeFor(resource, r.Method))
+		})
+	}
 }
-
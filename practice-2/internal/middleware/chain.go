@@ -0,0 +1,73 @@
+package middleware
+
+import "net/http"
+
+// Middleware wraps a handler with extra behaviour
+type Middleware func(http.Handler) http.Handler
+
+// Chain is an ordered list of middleware. They run in the order they were
+// added: the first sees the request first and the response last. Chains are
+// values; Use returns a new chain and never changes the one it was called
+// on, so a shared base can be extended per group.
+type Chain struct {
+	mws []Middleware
+}
+
+// NewChain returns a chain of mws
+func NewChain(mws ...Middleware) Chain {
+	return Chain{}.Use(mws...)
+}
+
+// Use returns a chain that runs mws after the existing middleware
+func (c Chain) Use(mws ...Middleware) Chain {
+	next := make([]Middleware, 0, len(c.mws)+len(mws))
+	next = append(next, c.mws...)
+	for _, mw := range mws {
+		if mw != nil {
+			next = append(next, mw)
+		}
+	}
+	return Chain{mws: next}
+}
+
+// Then wraps h so that the chain's middleware run before it
+func (c Chain) Then(h http.Handler) http.Handler {
+	for i := len(c.mws) - 1; i >= 0; i-- {
+		h = c.mws[i](h)
+	}
+	return h
+}
+
+// ThenFunc is Then for a handler function
+func (c Chain) ThenFunc(fn http.HandlerFunc) http.Handler {
+	return c.Then(fn)
+}
+
+// Group registers routes on a mux behind a chain, such as public routes
+// versus routes that need authentication. Middleware that must see every
+// request, matched or not, belongs on the chain wrapping the mux instead.
+type Group struct {
+	mux   *http.ServeMux
+	chain Chain
+}
+
+// NewGroup returns a group registering on mux behind mws
+func NewGroup(mux *http.ServeMux, mws ...Middleware) *Group {
+	return &Group{mux: mux, chain: NewChain(mws...)}
+}
+
+// Group returns a subgroup on the same mux whose routes run mws after this
+// group's middleware
+func (g *Group) Group(mws ...Middleware) *Group {
+	return &Group{mux: g.mux, chain: g.chain.Use(mws...)}
+}
+
+// Handle registers h for pattern behind the group's middleware
+func (g *Group) Handle(pattern string, h http.Handler) {
+	g.mux.Handle(pattern, g.chain.Then(h))
+}
+
+// HandleFunc registers fn for pattern behind the group's middleware
+func (g *Group) HandleFunc(pattern string, fn http.HandlerFunc) {
+	g.Handle(pattern, fn)
+}
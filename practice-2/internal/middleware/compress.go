@@ -0,0 +1,306 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"tiny-http/internal/hmacauth"
+	"tiny-http/internal/problem"
+)
+
+// CompressOptions controls Compress. MinSize is the smallest response body
+// worth compressing; MaxRequestBody bounds gzip request bodies after
+// decompression.
+type CompressOptions struct {
+	MinSize        int
+	MaxRequestBody int64
+}
+
+// Encoders are pooled: a gzip.Writer allocates several hundred KB
+var (
+	gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(io.Discard) }}
+	zlibWriters = sync.Pool{New: func() any { return zlib.NewWriter(io.Discard) }}
+	gzipReaders sync.Pool
+)
+
+// encoder is the part of gzip.Writer and zlib.Writer Compress uses
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// Compress gzip- or deflate-encodes responses for clients that accept it,
+// choosing by the q-values in Accept-Encoding. Bodies under MinSize,
+// responses that already have a Content-Encoding and already compressed
+// content types such as images and archives are sent as they are.
+// Responses big enough to compress get Vary: Accept-Encoding whether or not
+// this client accepted an encoding, so caches keep the variants apart.
+//
+// Request bodies sent with Content-Encoding: gzip are decompressed before
+// the handler sees them, so Idempotency-Key fingerprints cover the
+// decompressed body. A signed request's compressed body is kept as an
+// hmacauth.EncodedBody, since its signature covers the bytes as sent.
+// Reading more than MaxRequestBody decompressed bytes fails with
+// *http.MaxBytesError, as does a signed body over MaxRequestBody compressed.
+// Other request encodings get 415.
+func Compress(opts CompressOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ce := r.Header.Get("Content-Encoding"); ce != "" && r.Body != nil && r.Body != http.NoBody {
+				if !strings.EqualFold(ce, "gzip") {
+					w.Header().Set("Accept-Encoding", "gzip")
+					problem.Write(w, r, http.StatusUnsupportedMediaType, "unsupported Content-Encoding "+ce)
+					return
+				}
+				var sent []byte
+				body := r.Body
+				if hmacauth.Signed(r) {
+					var err error
+					sent, err = io.ReadAll(http.MaxBytesReader(w, r.Body, opts.MaxRequestBody))
+					if err != nil {
+						problem.Write(w, r, http.StatusRequestEntityTooLarge, "request body too large")
+						return
+					}
+					body = io.NopCloser(bytes.NewReader(sent))
+				}
+				zr, err := gzipReader(body)
+				if err != nil {
+					problem.Write(w, r, http.StatusBadRequest, "invalid gzip request body")
+					return
+				}
+				defer gzipReaders.Put(zr)
+				// The request is changed in place rather than copied so the
+				// outer middleware still see the route pattern the mux sets
+				r.Body = http.MaxBytesReader(w, zr, opts.MaxRequestBody)
+				if sent != nil {
+					r.Body = &hmacauth.EncodedBody{ReadCloser: r.Body, Encoded: sent}
+				}
+				r.Header.Del("Content-Encoding")
+				r.Header.Del("Content-Length")
+				r.ContentLength = -1
+			}
+
+			cw := &compressWriter{
+				wrappedWriter: wrappedWriter{w},
+				encoding:      negotiateEncoding(r.Header.Values("Accept-Encoding")),
+				minSize:       opts.MinSize,
+			}
+			next.ServeHTTP(cw, r)
+			cw.finish()
+		})
+	}
+}
+
+// gzipReader returns a pooled gzip.Reader reading body
+func gzipReader(body io.Reader) (*gzip.Reader, error) {
+	if zr, ok := gzipReaders.Get().(*gzip.Reader); ok {
+		if err := zr.Reset(body); err != nil {
+			gzipReaders.Put(zr)
+			return nil, err
+		}
+		return zr, nil
+	}
+	return gzip.NewReader(body)
+}
+
+// negotiateEncoding picks gzip or deflate from Accept-Encoding, preferring
+// gzip on equal q-values, or returns "" for an unencoded response
+func negotiateEncoding(accept []string) string {
+	best, bestQ := "", 0.0
+	star := -1.0
+	q := map[string]float64{}
+	for _, line := range accept {
+		for _, part := range strings.Split(line, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			weight := 1.0
+			if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				f, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					continue
+				}
+				weight = f
+			}
+			if name == "*" {
+				star = weight
+				continue
+			}
+			q[name] = weight
+		}
+	}
+	for _, enc := range []string{"gzip", "deflate"} {
+		w, ok := q[enc]
+		if !ok && enc == "gzip" {
+			w, ok = q["x-gzip"]
+		}
+		if !ok {
+			w = star
+		}
+		if w > bestQ {
+			best, bestQ = enc, w
+		}
+	}
+	return best
+}
+
+// incompressible reports whether content of type ct is already compressed
+func incompressible(ct string) bool {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	switch {
+	case mt == "image/svg+xml":
+		return false
+	case strings.HasPrefix(mt, "image/"), strings.HasPrefix(mt, "video/"), strings.HasPrefix(mt, "audio/"),
+		strings.HasPrefix(mt, "font/woff"):
+		return true
+	}
+	switch mt {
+	case "application/gzip", "application/x-gzip", "application/zip", "application/zstd",
+		"application/x-bzip2", "application/x-xz", "application/x-7z-compressed",
+		"application/x-rar-compressed", "application/pdf":
+		return true
+	}
+	return false
+}
+
+// compressWriter holds back the status and the first MinSize bytes of the
+// body until it knows whether to compress them
+type compressWriter struct {
+	wrappedWriter
+	encoding string
+	minSize  int
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     encoder
+}
+
+func (c *compressWriter) WriteHeader(code int) {
+	if code >= 100 && code < 200 {
+		c.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if c.status == 0 {
+		c.status = code
+	}
+}
+
+func (c *compressWriter) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	if !c.decided {
+		c.buf = append(c.buf, b...)
+		if len(c.buf) < c.minSize {
+			return len(b), nil
+		}
+		if err := c.start(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if c.enc != nil {
+		return c.enc.Write(b)
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+// Flush sends what has been written so far. A streaming response is
+// compressed even if it is still under MinSize, since more is to come.
+func (c *compressWriter) Flush() {
+	if !c.decided {
+		if c.status == 0 {
+			c.status = http.StatusOK
+		}
+		if err := c.start(true); err != nil {
+			return
+		}
+	}
+	if c.enc != nil {
+		c.enc.Flush()
+	}
+	c.wrappedWriter.Flush()
+}
+
+// start decides whether to compress, sends the header and the buffered
+// body. big says the body has reached MinSize or is being streamed.
+func (c *compressWriter) start(big bool) error {
+	c.decided = true
+	h := c.Header()
+	if h.Get("Content-Type") == "" && len(c.buf) > 0 && h.Get("X-Content-Type-Options") != "nosniff" {
+		h.Set("Content-Type", http.DetectContentType(c.buf))
+	}
+
+	eligible := big &&
+		c.status != http.StatusNoContent && c.status != http.StatusNotModified &&
+		h.Get("Content-Encoding") == "" && !incompressible(h.Get("Content-Type"))
+	if eligible {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	if eligible && c.encoding != "" {
+		h.Set("Content-Encoding", c.encoding)
+		h.Del("Content-Length")
+		// the encoded body is a different byte sequence, so a strong
+		// validator no longer applies to it
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		if c.encoding == "gzip" {
+			c.enc = gzipWriters.Get().(*gzip.Writer)
+		} else {
+			c.enc = zlibWriters.Get().(*zlib.Writer)
+		}
+		c.enc.Reset(c.ResponseWriter)
+	}
+
+	c.ResponseWriter.WriteHeader(c.status)
+	buf := c.buf
+	c.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if c.enc != nil {
+		_, err = c.enc.Write(buf)
+	} else {
+		_, err = c.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// finish sends a response that stayed under MinSize and closes the
+// encoder, returning it to its pool
+func (c *compressWriter) finish() {
+	if !c.decided {
+		if c.status == 0 {
+			if len(c.buf) == 0 {
+				return
+			}
+			c.status = http.StatusOK
+		}
+		c.start(false)
+	}
+	if c.enc == nil {
+		return
+	}
+	c.enc.Close()
+	c.enc.Reset(io.Discard)
+	switch e := c.enc.(type) {
+	case *gzip.Writer:
+		gzipWriters.Put(e)
+	case *zlib.Writer:
+		zlibWriters.Put(e)
+	}
+	c.enc = nil
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tiny-http/internal/apikey"
+	"tiny-http/internal/hmacauth"
+	"tiny-http/signing"
+)
+
+// A client that gzips its body signs the compressed bytes it sends, so the
+// verifier has to hash those rather than what Compress decodes them to.
+func TestCompressSignedGzipBody(t *testing.T) {
+	const secret = "0123456789abcdef0123456789abcdef"
+	verifier := hmacauth.NewVerifier(
+		hmacauth.NewMemoryStore(hmacauth.Key{ID: "billing", Secret: secret, Scopes: []string{apikey.ScopeUsersWrite}}),
+		hmacauth.NewMemoryNonces(), time.Minute)
+
+	var got []byte
+	h := NewChain(
+		Compress(CompressOptions{MinSize: 1024, MaxRequestBody: 1 << 20}),
+		AuthMiddleware(Authenticators{Keys: apikey.NewMemoryStore(), Signatures: verifier}, "users"),
+	).Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = io.ReadAll(r.Body)
+	}))
+
+	const body = `{"name":"Alice","email":"alice@example.com"}`
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	io.WriteString(zw, body)
+	zw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewReader(gz.Bytes()))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	signer := &signing.Signer{KeyID: "billing", Secret: []byte(secret)}
+	if err := signer.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if string(got) != body {
+		t.Errorf("handler read %q, want the decompressed body", got)
+	}
+}
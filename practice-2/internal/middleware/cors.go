@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions configures the CORS middleware
+type CORSOptions struct {
+	// Origins are exact origins ("https://app.example.com"), wildcard
+	// subdomains ("https://*.example.com", which doesn't match the apex)
+	// or "*" for any origin
+	Origins     []string
+	Methods     []string
+	Headers     []string
+	Credentials bool
+	MaxAge      time.Duration
+}
+
+// corsExposed are the response headers browser code may read
+var corsExposed = []string{
+	"X-Request-ID", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset",
+	"Retry-After", "Location", "Deprecation", "Link", "WWW-Authenticate", "Idempotent-Replayed",
+}
+
+// originMatcher checks request origins against the configured patterns
+type originMatcher struct {
+	any      bool
+	exact    map[string]bool
+	suffixes [][2]string // scheme prefix, host suffix
+}
+
+func newOriginMatcher(patterns []string) originMatcher {
+	m := originMatcher{exact: map[string]bool{}}
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSuffix(p, "/"))
+		switch {
+		case p == "*":
+			m.any = true
+		case strings.Contains(p, "://*."):
+			scheme, host, _ := strings.Cut(p, "://*")
+			m.suffixes = append(m.suffixes, [2]string{scheme + "://", host})
+		default:
+			m.exact[p] = true
+		}
+	}
+	return m
+}
+
+func (m originMatcher) allowed(origin string) bool {
+	origin = strings.ToLower(origin)
+	if m.any || m.exact[origin] {
+		return true
+	}
+	for _, s := range m.suffixes {
+		// require a non-empty label before the suffix
+		if rest, ok := strings.CutPrefix(origin, s[0]); ok && strings.HasSuffix(rest, s[1]) &&
+			len(rest) > len(s[1]) && !strings.Contains(rest, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// CORS adds the CORS response headers for allowed origins and answers
+// preflight requests itself, so it must run before any authentication:
+// browsers never send credentials on a preflight. Preflights from
+// disallowed origins, or asking for a method or header outside opts, get an
+// empty 204 the browser will reject. Credentials are never allowed for "*":
+// config rejects the combination, and reflecting any origin with
+// credentials would let every website act as the browser's user.
+func CORS(opts CORSOptions) func(http.Handler) http.Handler {
+	origins := newOriginMatcher(opts.Origins)
+	if origins.any {
+		opts.Credentials = false
+	}
+	methods := strings.Join(opts.Methods, ", ")
+	headers := strings.Join(opts.Headers, ", ")
+	exposed := strings.Join(corsExposed, ", ")
+	maxAge := strconv.Itoa(int(opts.MaxAge.Seconds()))
+
+	allowedHeader := func(h string) bool {
+		return slices.ContainsFunc(opts.Headers, func(a string) bool { return strings.EqualFold(a, h) })
+	}
+	allowedRequest := func(r *http.Request) bool {
+		if !slices.Contains(opts.Methods, r.Header.Get("Access-Control-Request-Method")) {
+			return false
+		}
+		for _, h := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+			if h = strings.TrimSpace(h); h != "" && !allowedHeader(h) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && origin != "" &&
+				r.Header.Get("Access-Control-Request-Method") != ""
+
+			// Responses differ per origin, so shared caches must key on it
+			h.Add("Vary", "Origin")
+			if preflight {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+			}
+
+			allowed := origin != "" && origins.allowed(origin)
+			if allowed {
+				if origins.any {
+					h.Set("Access-Control-Allow-Origin", "*")
+				} else {
+					h.Set("Access-Control-Allow-Origin", origin)
+				}
+				if opts.Credentials {
+					h.Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+
+			if !preflight {
+				if allowed {
+					h.Set("Access-Control-Expose-Headers", exposed)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if allowed && allowedRequest(r) {
+				h.Set("Access-Control-Allow-Methods", methods)
+				if headers != "" {
+					h.Set("Access-Control-Allow-Headers", headers)
+				}
+				if opts.MaxAge > 0 {
+					h.Set("Access-Control-Max-Age", maxAge)
+				}
+			} else {
+				h.Del("Access-Control-Allow-Origin")
+				h.Del("Access-Control-Allow-Credentials")
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
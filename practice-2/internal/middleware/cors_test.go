@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+var corsOpts = CORSOptions{
+	Origins: []string{"https://app.example.com", "https://*.example.org"},
+	Methods: []string{http.MethodGet, http.MethodPost},
+	Headers: []string{"Content-Type", "X-API-Key", "X-Tenant-ID", "X-Signature", "X-Signature-Key-Id",
+		"X-Signature-Timestamp", "X-Signature-Nonce"},
+	MaxAge: 10 * time.Minute,
+}
+
+// serveCORS sends r through CORS to a handler answering 200 and reports
+// whether the handler ran
+func serveCORS(opts CORSOptions, r *http.Request) (*httptest.ResponseRecorder, bool) {
+	called := false
+	h := CORS(opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec, called
+}
+
+func preflight(origin, method, headers string) *http.Request {
+	r := httptest.NewRequest(http.MethodOptions, "/users", nil)
+	r.Header.Set("Origin", origin)
+	r.Header.Set("Access-Control-Request-Method", method)
+	if headers != "" {
+		r.Header.Set("Access-Control-Request-Headers", headers)
+	}
+	return r
+}
+
+func TestCORSPreflight(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     *http.Request
+		allowed bool
+	}{
+		{"allowed", preflight("https://app.example.com", "POST", "content-type, x-api-key"), true},
+		{"tenant and signature headers", preflight("https://app.example.com", "POST",
+			"X-Tenant-ID, X-Signature, X-Signature-Key-Id, X-Signature-Timestamp, X-Signature-Nonce"), true},
+		{"wildcard subdomain", preflight("https://a.example.org", "GET", ""), true},
+		{"wildcard apex", preflight("https://example.org", "GET", ""), false},
+		{"other origin", preflight("https://evil.example.net", "GET", ""), false},
+		{"other scheme", preflight("http://app.example.com", "GET", ""), false},
+		{"method not allowed", preflight("https://app.example.com", "DELETE", ""), false},
+		{"header not allowed", preflight("https://app.example.com", "POST", "X-Debug"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, called := serveCORS(corsOpts, tt.req)
+			if called {
+				t.Error("preflight reached the handler")
+			}
+			if rec.Code != http.StatusNoContent {
+				t.Errorf("status = %d, want 204", rec.Code)
+			}
+			h := rec.Header()
+			if got := h.Get("Access-Control-Allow-Origin") != ""; got != tt.allowed {
+				t.Fatalf("Access-Control-Allow-Origin = %q, want allowed %v", h.Get("Access-Control-Allow-Origin"), tt.allowed)
+			}
+			if !tt.allowed {
+				if h.Get("Access-Control-Allow-Methods") != "" {
+					t.Errorf("rejected preflight got Access-Control-Allow-Methods %q", h.Get("Access-Control-Allow-Methods"))
+				}
+				return
+			}
+			if h.Get("Access-Control-Allow-Origin") != tt.req.Header.Get("Origin") {
+				t.Errorf("Access-Control-Allow-Origin = %q, want the request origin", h.Get("Access-Control-Allow-Origin"))
+			}
+			if h.Get("Access-Control-Allow-Methods") != "GET, POST" || h.Get("Access-Control-Max-Age") != "600" {
+				t.Errorf("headers = %v", h)
+			}
+			if h.Get("Access-Control-Allow-Credentials") != "" {
+				t.Error("credentials allowed without opts.Credentials")
+			}
+		})
+	}
+}
+
+func TestCORSVary(t *testing.T) {
+	rec, _ := serveCORS(corsOpts, preflight("https://app.example.com", "GET", ""))
+	vary := rec.Header().Values("Vary")
+	for _, want := range []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"} {
+		if !slices.Contains(vary, want) {
+			t.Errorf("preflight Vary = %v, missing %s", vary, want)
+		}
+	}
+
+	// a disallowed origin still varies the response, or a cache could hand
+	// it to an allowed one
+	r := httptest.NewRequest(http.MethodGet, "/users", nil)
+	r.Header.Set("Origin", "https://evil.example.net")
+	rec, called := serveCORS(corsOpts, r)
+	if !called {
+		t.Error("simple request didn't reach the handler")
+	}
+	if !slices.Contains(rec.Header().Values("Vary"), "Origin") {
+		t.Errorf("Vary = %v, want Origin", rec.Header().Values("Vary"))
+	}
+	if rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("disallowed origin was allowed")
+	}
+}
+
+func TestCORSSimpleRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/users", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	rec, called := serveCORS(corsOpts, r)
+	if !called {
+		t.Fatal("request didn't reach the handler")
+	}
+	if rec.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q", rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if rec.Header().Get("Access-Control-Expose-Headers") == "" {
+		t.Error("no Access-Control-Expose-Headers")
+	}
+}
+
+func TestCORSAnyOriginNeverAllowsCredentials(t *testing.T) {
+	opts := corsOpts
+	opts.Origins = []string{"*"}
+	opts.Credentials = true
+
+	r := httptest.NewRequest(http.MethodGet, "/users", nil)
+	r.Header.Set("Origin", "https://evil.example.net")
+	rec, _ := serveCORS(opts, r)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+	if rec.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Error("credentials allowed for any origin")
+	}
+}
+
+func TestCORSCredentials(t *testing.T) {
+	opts := corsOpts
+	opts.Credentials = true
+	rec, _ := serveCORS(opts, preflight("https://app.example.com", "GET", ""))
+	if rec.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("headers = %v, want credentials allowed", rec.Header())
+	}
+}
@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"tiny-http/internal/idempotency"
+	"tiny-http/internal/problem"
+)
+
+// IdempotencyHeader is the request header carrying the client's key
+const IdempotencyHeader = "Idempotency-Key"
+
+// maxIdempotentBody is the largest request body fingerprinted and the
+// largest response body stored; bigger requests skip deduplication and are
+// left for the handler to reject, bigger responses aren't replayed
+const maxIdempotentBody = 1 << 20
+
+// Idempotency deduplicates unsafe requests carrying an Idempotency-Key.
+// The first request's status, headers and body are kept for ttl and
+// replayed for retries with the same method, path and body; a different
+// request under the same key gets 422 and a retry that arrives while the
+// first is still running gets 409. Keys are scoped to the caller, so it must
+// run after the auth middlewares. 5xx responses and responses over 1 MiB
+// aren't stored, so a retry runs the handler again.
+func Idempotency(store idempotency.Store, ttl time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyHeader)
+			if key == "" || safeMethod(r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > 255 {
+				problem.Write(w, r, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBody+1))
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			if err != nil || len(body) > maxIdempotentBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			sum := sha256.New()
+			io.WriteString(sum, r.Method+" "+r.URL.Path+"\n")
+			sum.Write(body)
+			fingerprint := hex.EncodeToString(sum.Sum(nil))
+			storeKey := rateLimitKey(r) + "|" + key
+
+			stored, err := store.Begin(r.Context(), storeKey, fingerprint, ttl)
+			switch {
+			case errors.Is(err, idempotency.ErrMismatch):
+				problem.Write(w, r, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+				return
+			case errors.Is(err, idempotency.ErrInFlight):
+				w.Header().Set("Retry-After", "1")
+				problem.Write(w, r, http.StatusConflict, "a request with this Idempotency-Key is still in progress")
+				return
+			case err != nil:
+				logError(r, "idempotency begin", err)
+				next.ServeHTTP(w, r)
+				return
+			case stored != nil:
+				replay(w, stored)
+				return
+			}
+
+			rec := &responseCapture{wrappedWriter: wrappedWriter{w}}
+			completed := false
+			defer func() {
+				// a panic or server error frees the key for a retry
+				if !completed {
+					if err := store.Release(r.Context(), storeKey); err != nil {
+						logError(r, "idempotency release", err)
+					}
+				}
+			}()
+			next.ServeHTTP(rec, r)
+
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			if rec.status >= 500 || rec.overflow {
+				return
+			}
+			resp := idempotency.Response{Status: rec.status, Header: rec.header, Body: rec.body.Bytes()}
+			if err := store.Complete(r.Context(), storeKey, resp); err != nil {
+				logError(r, "idempotency complete", err)
+				return
+			}
+			completed = true
+		})
+	}
+}
+
+// safeMethod reports whether method is read-only by definition
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// replay writes a stored response, marked with Idempotent-Replayed.
+// Headers already set by the middlewares for this request, such as the
+// request id, rate limit and CORS headers, take precedence over stored ones.
+func replay(w http.ResponseWriter, resp *idempotency.Response) {
+	h := w.Header()
+	for k, v := range resp.Header {
+		if _, ok := h[k]; !ok {
+			h[k] = v
+		}
+	}
+	h.Set("Idempotent-Replayed", "true")
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
+
+// responseCapture copies the response into memory as it is written, up to
+// maxIdempotentBody
+type responseCapture struct {
+	wrappedWriter
+	status   int
+	header   http.Header
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (c *responseCapture) WriteHeader(code int) {
+	if c.status == 0 {
+		c.status = code
+		c.header = c.ResponseWriter.Header().Clone()
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *responseCapture) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	switch {
+	case c.overflow:
+	case c.body.Len()+len(b) > maxIdempotentBody:
+		c.overflow = true
+		c.body = bytes.Buffer{}
+	default:
+		c.body.Write(b)
+	}
+	return c.ResponseWriter.Write(b)
+}
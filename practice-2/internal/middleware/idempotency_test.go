@@ -0,0 +1,175 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tiny-http/internal/idempotency"
+)
+
+// idempotentServer runs handler behind Idempotency, as the caller named in
+// the X-Test-Caller header
+func idempotentServer(store idempotency.Store, handler http.HandlerFunc) http.Handler {
+	h := Idempotency(store, time.Hour)(handler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c := r.Header.Get("X-Test-Caller"); c != "" {
+			r = r.WithContext(ContextWithIdentity(r.Context(), Identity{ID: c, Method: MethodAPIKey}))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func idempotentPost(h http.Handler, caller, key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+	r.Header.Set("X-Test-Caller", caller)
+	if key != "" {
+		r.Header.Set(IdempotencyHeader, key)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+// creator answers 201 with a body numbering its calls
+func creator(calls *atomic.Int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		w.Header().Set("Location", "/users/"+strconv.Itoa(int(n)))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":` + strconv.Itoa(int(n)) + `}`))
+	}
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	var calls atomic.Int32
+	h := idempotentServer(idempotency.NewMemory(1<<20), creator(&calls))
+
+	first := idempotentPost(h, "alice", "k1", `{"name":"Alice"}`)
+	second := idempotentPost(h, "alice", "k1", `{"name":"Alice"}`)
+
+	if calls.Load() != 1 {
+		t.Fatalf("handler ran %d times, want once", calls.Load())
+	}
+	if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() ||
+		second.Header().Get("Location") != "/users/1" {
+		t.Errorf("replay = %d %q %v, want the first response", second.Code, second.Body, second.Header())
+	}
+	if second.Header().Get("Idempotent-Replayed") != "true" || first.Header().Get("Idempotent-Replayed") != "" {
+		t.Error("Idempotent-Replayed should only mark the replay")
+	}
+}
+
+func TestIdempotencyDifferentBody(t *testing.T) {
+	var calls atomic.Int32
+	h := idempotentServer(idempotency.NewMemory(1<<20), creator(&calls))
+
+	idempotentPost(h, "alice", "k1", `{"name":"Alice"}`)
+	rec := idempotentPost(h, "alice", "k1", `{"name":"Bob"}`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("same key, different body: status = %d, want 422", rec.Code)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("handler ran %d times, want once", calls.Load())
+	}
+}
+
+func TestIdempotencyInFlight(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	h := idempotentServer(idempotency.NewMemory(1<<20), func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- idempotentPost(h, "alice", "k1", `{}`) }()
+	<-started
+
+	rec := idempotentPost(h, "alice", "k1", `{}`)
+	if rec.Code != http.StatusConflict || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("retry while in flight: status = %d, Retry-After %q; want 409 with Retry-After",
+			rec.Code, rec.Header().Get("Retry-After"))
+	}
+	close(release)
+	if first := <-done; first.Code != http.StatusCreated {
+		t.Errorf("first request: status = %d, want 201", first.Code)
+	}
+}
+
+func TestIdempotencyKeysPerCaller(t *testing.T) {
+	var calls atomic.Int32
+	h := idempotentServer(idempotency.NewMemory(1<<20), creator(&calls))
+
+	alice := idempotentPost(h, "alice", "k1", `{}`)
+	bob := idempotentPost(h, "bob", "k1", `{}`)
+	if calls.Load() != 2 || bob.Body.String() == alice.Body.String() {
+		t.Errorf("handler ran %d times; bob got %q, alice %q; want bob's own response", calls.Load(), bob.Body, alice.Body)
+	}
+}
+
+func TestIdempotencyNotStored(t *testing.T) {
+	tests := []struct {
+		name    string
+		store   idempotency.Store
+		handler func(calls *atomic.Int32) http.HandlerFunc
+	}{
+		{"server error", idempotency.NewMemory(1 << 20), func(calls *atomic.Int32) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}},
+		{"body over 1 MiB", idempotency.NewMemory(64 << 20), func(calls *atomic.Int32) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				for range 3 {
+					w.Write(make([]byte, maxIdempotentBody/2))
+				}
+			}
+		}},
+		{"body over the store's budget", idempotency.NewMemory(16), creator},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			h := idempotentServer(tt.store, tt.handler(&calls))
+			first := idempotentPost(h, "alice", "k1", `{}`)
+			second := idempotentPost(h, "alice", "k1", `{}`)
+
+			if calls.Load() != 2 {
+				t.Errorf("handler ran %d times, want the retry to run it again", calls.Load())
+			}
+			if second.Header().Get("Idempotent-Replayed") != "" {
+				t.Error("retry was replayed")
+			}
+			if first.Body.Len() != second.Body.Len() {
+				t.Errorf("bodies of %d and %d bytes, want the handler's full body both times", first.Body.Len(), second.Body.Len())
+			}
+		})
+	}
+}
+
+func TestIdempotencySkips(t *testing.T) {
+	var calls atomic.Int32
+	h := idempotentServer(idempotency.NewMemory(1<<20), creator(&calls))
+
+	for range 2 {
+		idempotentPost(h, "alice", "", `{}`)
+		r := httptest.NewRequest(http.MethodGet, "/users", nil)
+		r.Header.Set(IdempotencyHeader, "k1")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if calls.Load() != 4 {
+		t.Errorf("handler ran %d times, want every request without a key or with a safe method to run", calls.Load())
+	}
+
+	rec := idempotentPost(h, "alice", strings.Repeat("k", 256), `{}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("256 character key: status = %d, want 400", rec.Code)
+	}
+}
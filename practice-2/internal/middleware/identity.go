@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"slices"
+
+	"tiny-http/internal/apikey"
+	"tiny-http/internal/problem"
+	"tiny-http/internal/tenant"
+)
+
+// Authentication methods recorded in Identity.Method
+const (
+	MethodAPIKey    = "api_key"
+	MethodJWT       = "jwt"
+	MethodMTLS      = "mtls"
+	MethodSignature = "signature"
+)
+
+// TenantHeader lets a cross-tenant admin act for a single tenant, e.g. to
+// create users in it; other callers may only name their own tenant
+const TenantHeader = "X-Tenant-ID"
+
+// Identity is the authenticated caller, whichever way it authenticated
+type Identity struct {
+	ID     string
+	Name   string
+	Tenant string
+	Scopes []string
+	Method string
+}
+
+// HasScope reports whether the identity was granted scope
+func (id Identity) HasScope(scope string) bool {
+	return slices.Contains(id.Scopes, scope)
+}
+
+// IdentityFromContext returns the caller set by one of the auth middlewares
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityContextKey).(Identity)
+	return id, ok
+}
+
+// ContextWithIdentity returns ctx carrying id and the tenant.Scope it acts
+// in: its own tenant, widened to every tenant for holders of
+// apikey.ScopeTenantsAdmin. Authenticators outside this package, such as
+// the gRPC interceptors, use it too.
+func ContextWithIdentity(ctx context.Context, id Identity) context.Context {
+	id.Tenant = tenant.Name(id.Tenant)
+	ctx = context.WithValue(ctx, identityContextKey, id)
+	return tenant.NewContext(ctx, tenant.Scope{ID: id.Tenant, All: id.HasScope(apikey.ScopeTenantsAdmin)})
+}
+
+// authorize checks that id holds the scope r needs on resource and calls next
+// with id and its tenant scope stored in the request context. An admin's
+// X-Tenant-ID narrows the scope to that tenant.
+func authorize(w http.ResponseWriter, r *http.Request, next http.Handler, id Identity, scope string) {
+	if !id.HasScope(scope) {
+		authFailures.With(reasonInsufficientScope).Inc()
+		problem.Write(w, r, http.StatusForbidden, "insufficient scope")
+		return
+	}
+	ctx := ContextWithIdentity(r.Context(), id)
+	if t := r.Header.Get(TenantHeader); t != "" {
+		switch {
+		case id.HasScope(apikey.ScopeTenantsAdmin):
+			ctx = tenant.NewContext(ctx, tenant.Scope{ID: t})
+		case t != tenant.Name(id.Tenant):
+			authFailures.With(reasonInsufficientScope).Inc()
+			problem.Write(w, r, http.StatusForbidden, TenantHeader+" for another tenant needs the "+
+				apikey.ScopeTenantsAdmin+" scope")
+			return
+		}
+	}
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tiny-http/internal/apikey"
+	"tiny-http/internal/tenant"
+)
+
+func TestAPIKeyTenantScope(t *testing.T) {
+	store := apikey.NewMemoryStore(
+		apikey.Key{ID: "a", Hash: apikey.HashSecret("key-a"), Tenant: "team-a",
+			Scopes: []string{apikey.ScopeUsersRead}},
+		apikey.Key{ID: "legacy", Hash: apikey.HashSecret("key-legacy"),
+			Scopes: []string{apikey.ScopeUsersRead}},
+		apikey.Key{ID: "admin", Hash: apikey.HashSecret("key-admin"), Tenant: "ops",
+			Scopes: []string{apikey.ScopeUsersRead, apikey.ScopeTenantsAdmin}},
+	)
+
+	tests := []struct {
+		name       string
+		secret     string
+		tenantHdr  string
+		wantStatus int
+		wantScope  tenant.Scope
+	}{
+		{"own tenant", "key-a", "", http.StatusOK, tenant.Scope{ID: "team-a"}},
+		{"own tenant named", "key-a", "team-a", http.StatusOK, tenant.Scope{ID: "team-a"}},
+		{"key without tenant", "key-legacy", "", http.StatusOK, tenant.Scope{ID: tenant.Default}},
+		{"other tenant", "key-a", "team-b", http.StatusForbidden, tenant.Scope{}},
+		{"admin", "key-admin", "", http.StatusOK, tenant.Scope{ID: "ops", All: true}},
+		{"admin narrowed", "key-admin", "team-b", http.StatusOK, tenant.Scope{ID: "team-b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got tenant.Scope
+			h := APIKeyMiddleware(store, "users")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = tenant.FromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			req.Header.Set("X-API-Key", tt.secret)
+			if tt.tenantHdr != "" {
+				req.Header.Set(TenantHeader, tt.tenantHdr)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got != tt.wantScope {
+				t.Errorf("scope = %+v, want %+v", got, tt.wantScope)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"tiny-http/internal/apikey"
+	"tiny-http/internal/certs"
+	"tiny-http/internal/hmacauth"
+	"tiny-http/internal/problem"
+	"tiny-http/internal/token"
+)
+
+// ClaimsFromContext returns the access token claims verified by JWTMiddleware
+func ClaimsFromContext(ctx context.Context) (token.Claims, bool) {
+	c, ok := ctx.Value(claimsContextKey).(token.Claims)
+	return c, ok
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer" header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, tok, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || tok == "" {
+		return "", false
+	}
+	return strings.TrimSpace(tok), true
+}
+
+// JWTMiddleware validates an "Authorization: Bearer" access token issued by
+// tokens and requires the scope the request method needs on resource
+func JWTMiddleware(tokens *token.Manager, resource string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tok, ok := bearerToken(r)
+			if !ok {
+				authFailures.With(reasonMissingToken).Inc()
+				w.Header().Set("WWW-Authenticate", `Bearer realm="tiny-http"`)
+				problem.Write(w, r, http.StatusUnauthorized, "missing bearer token")
+				return
+			}
+
+			_, end := traceAuth(r, MethodJWT)
+			claims, err := tokens.Verify(tok, token.TypeAccess)
+			end(err)
+			if err != nil {
+				msg, reason := "invalid token", reasonInvalidToken
+				if errors.Is(err, token.ErrExpired) {
+					msg, reason = "token expired", reasonExpiredToken
+				}
+				authFailures.With(reason).Inc()
+				w.Header().Set("WWW-Authenticate", `Bearer realm="tiny-http", error="invalid_token"`)
+				problem.Write(w, r, http.StatusUnauthorized, msg)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), claimsContextKey, claims)
+			authorize(w, r.WithContext(ctx), next, Identity{
+				ID:     claims.Subject,
+				Name:   claims.Name,
+				Tenant: claims.Tenant,
+				Scopes: claims.Scopes(),
+				Method: MethodJWT,
+			}, apikey.ScopeFor(resource, r.Method))
+		})
+	}
+}
+
+// Authenticators are the ways a caller can authenticate. Keys is required;
+// a nil field disables that method.
+type Authenticators struct {
+	Keys       apikey.Store
+	Tokens     *token.Manager
+	Clients    *certs.ClientMap
+	Signatures *hmacauth.Verifier
+}
+
+// AuthMiddleware accepts any of the configured authenticators and picks one
+// per request, in this order: a verified client certificate that
+// auth.Clients maps to a client, X-Signature headers, an Authorization:
+// Bearer token, and otherwise an X-API-Key.
+func AuthMiddleware(auth Authenticators, resource string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		byKey := APIKeyMiddleware(auth.Keys, resource)(next)
+		var byToken, byCert, bySignature http.Handler
+		if auth.Tokens != nil {
+			byToken = JWTMiddleware(auth.Tokens, resource)(next)
+		}
+		if auth.Clients != nil {
+			byCert = ClientCertMiddleware(auth.Clients, resource)(next)
+		}
+		if auth.Signatures != nil {
+			bySignature = SignatureMiddleware(auth.Signatures, resource)(next)
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if cert, ok := clientCert(r); ok && byCert != nil {
+				if _, ok := auth.Clients.Lookup(cert); ok {
+					byCert.ServeHTTP(w, r)
+					return
+				}
+			}
+			if hmacauth.Signed(r) && bySignature != nil {
+				bySignature.ServeHTTP(w, r)
+				return
+			}
+			if _, ok := bearerToken(r); ok && byToken != nil {
+				byToken.ServeHTTP(w, r)
+				return
+			}
+			byKey.ServeHTTP(w, r)
+		})
+	}
+}
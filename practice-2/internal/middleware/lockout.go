@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"tiny-http/internal/lockout"
+	"tiny-http/internal/metrics"
+	"tiny-http/internal/problem"
+	"tiny-http/internal/requestid"
+)
+
+var lockouts = metrics.NewCounterVec(metrics.Default,
+	"auth_lockouts_total", "Lockouts after repeated authentication failures by subject.",
+	"subject")
+
+// keyPrefixLen is how much of a presented API key identifies it for
+// lockouts; the full secret is never stored or logged
+const keyPrefixLen = 8
+
+// Lockout counts 401 responses from the auth middleware it wraps per client
+// IP and per API key prefix, and answers further requests from a locked out
+// subject with 429 and Retry-After. Clients in trusted are never locked out.
+// Each lockout is written to audit.
+func Lockout(tracker *lockout.Tracker, trusted []netip.Prefix, audit *slog.Logger) func(http.Handler) http.Handler {
+	isTrusted := func(ip string) bool {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return false
+		}
+		addr = addr.Unmap()
+		for _, p := range trusted {
+			if p.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := clientIP(r)
+			if isTrusted(ip) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			subjects := []string{"ip:" + ip}
+			prefix := ""
+			if key := r.Header.Get("X-API-Key"); len(key) >= keyPrefixLen {
+				prefix = key[:keyPrefixLen]
+				subjects = append(subjects, "key:"+prefix)
+			}
+
+			var wait time.Duration
+			for _, s := range subjects {
+				wait = max(wait, tracker.Locked(s))
+			}
+			if wait > 0 {
+				authFailures.With(reasonLockedOut).Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				problem.Write(w, r, http.StatusTooManyRequests, "too many failed authentication attempts")
+				return
+			}
+
+			rec := recordResponse(w)
+			next.ServeHTTP(rec, r)
+
+			switch {
+			case rec.status == http.StatusUnauthorized:
+				for _, s := range subjects {
+					lockedFor, failures := tracker.Fail(s)
+					if lockedFor == 0 {
+						continue
+					}
+					kind, _, _ := strings.Cut(s, ":")
+					lockouts.With(kind).Inc()
+					audit.WarnContext(r.Context(), "auth lockout",
+						"event", "auth.lockout",
+						"subject", kind,
+						"ip", ip,
+						"key_prefix", prefix,
+						"failures", failures,
+						"locked_for", lockedFor,
+						"request_id", requestid.FromContext(r.Context()),
+						"path", r.URL.Path,
+					)
+				}
+			case rec.status < 400 && prefix != "":
+				// the key's owner got in; earlier misses were likely typos
+				tracker.Succeed("key:" + prefix)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"tiny-http/internal/lockout"
+)
+
+func TestLockout(t *testing.T) {
+	tracker := lockout.NewTracker(lockout.Policy{Threshold: 2, Window: time.Minute, Base: time.Minute, Max: time.Hour})
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	h := Lockout(tracker, trusted, slog.New(slog.NewTextHandler(io.Discard, nil)))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-API-Key") != "good-key-123" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}))
+
+	send := func(ip, key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/users", nil)
+		r.RemoteAddr = ip + ":40000"
+		r.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+
+	for range 2 {
+		if rec := send("192.0.2.1", "bad-key-456"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("status = %d before the lockout, want 401", rec.Code)
+		}
+	}
+	rec := send("192.0.2.1", "good-key-123")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d once locked out, want 429", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want 60", got)
+	}
+
+	// the key prefix is locked out from other IPs too
+	if rec := send("192.0.2.2", "bad-key-456"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("locked key from another IP: status = %d, want 429", rec.Code)
+	}
+
+	for range 3 {
+		if rec := send("10.1.2.3", "wrong-key-789"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("trusted client: status = %d, want 401 every time", rec.Code)
+		}
+	}
+}
+
+func TestLockoutSuccessResetsKey(t *testing.T) {
+	tracker := lockout.NewTracker(lockout.Policy{Threshold: 2, Window: time.Minute, Base: time.Minute, Max: time.Hour})
+	fail := true
+	h := Lockout(tracker, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if fail {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}))
+	send := func(ip string) int {
+		r := httptest.NewRequest(http.MethodGet, "/users", nil)
+		r.RemoteAddr = ip + ":40000"
+		r.Header.Set("X-API-Key", "typo-key-123")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	send("192.0.2.1")
+	fail = false
+	send("192.0.2.2")
+	fail = true
+	// one more failure would lock the key if the earlier one still counted
+	send("192.0.2.3")
+	if code := send("192.0.2.4"); code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401: the success should have cleared the key's failures", code)
+	}
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"tiny-http/internal/requestid"
+	"tiny-http/internal/tracing"
+)
+
+// logError logs a failure of a backing store or other dependency that the
+// middleware handled without failing the request outright, with the same
+// request attributes as problem.HandlerFunc
+func logError(r *http.Request, msg string, err error, args ...any) {
+	slog.ErrorContext(r.Context(), msg, append([]any{
+		"request_id", requestid.FromContext(r.Context()),
+		"trace_id", tracing.TraceIDFromContext(r.Context()),
+		"method", r.Method,
+		"path", r.URL.Path,
+		"err", err,
+	}, args...)...)
+}
+
+// statusRecorder captures the status code and body size written by the
+// handlers it wraps
+type statusRecorder struct {
+	wrappedWriter
+	status int
+	bytes  int64
+}
+
+// recordResponse returns w as a statusRecorder, reusing the one an
+// enclosing middleware installed when nothing has wrapped w since, so
+// tracing, access logging and metrics share one wrapper per request
+func recordResponse(w http.ResponseWriter) *statusRecorder {
+	if rec, ok := w.(*statusRecorder); ok {
+		return rec
+	}
+	return &statusRecorder{wrappedWriter: wrappedWriter{w}}
+}
+
+// code returns the status written, 200 if the handler wrote nothing
+func (s *statusRecorder) code() int {
+	if s.status == 0 {
+		return http.StatusOK
+	}
+	return s.status
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += int64(n)
+	return n, err
+}
+
+// AccessLog writes one log record per request with its status, size,
+// duration, request id and, when tracing is on, trace id. 5xx responses are
+// logged at error level, 4xx at warn and everything else at info, so
+// LOG_LEVEL filters them as expected.
+func AccessLog(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := recordResponse(w)
+
+			next.ServeHTTP(rec, r)
+
+			status := rec.code()
+			level := slog.LevelInfo
+			switch {
+			case status >= 500:
+				level = slog.LevelError
+			case status >= 400:
+				level = slog.LevelWarn
+			}
+
+			attrs := []slog.Attr{
+				slog.String("request_id", requestid.FromContext(r.Context())),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.Int64("bytes", rec.bytes),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("remote", clientIP(r)),
+				slog.String("user_agent", r.UserAgent()),
+			}
+			if id := tracing.TraceIDFromContext(r.Context()); id != "" {
+				attrs = append(attrs, slog.String("trace_id", id))
+			}
+			logger.LogAttrs(r.Context(), level, "request", attrs...)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"tiny-http/internal/metrics"
+)
+
+var (
+	httpRequests = metrics.NewCounterVec(metrics.Default,
+		"http_requests_total", "HTTP requests by route pattern, method and status class.",
+		"route", "method", "status_class")
+	httpDuration = metrics.NewHistogramVec(metrics.Default,
+		"http_request_duration_seconds", "HTTP request latency by route pattern and method.",
+		metrics.DurationBuckets, "route", "method")
+	httpResponseSize = metrics.NewHistogramVec(metrics.Default,
+		"http_response_size_bytes", "HTTP response body size by route pattern.",
+		metrics.SizeBuckets, "route")
+	httpInFlight = metrics.NewGaugeVec(metrics.Default,
+		"http_requests_in_flight", "HTTP requests currently being served.").With()
+	authFailures = metrics.NewCounterVec(metrics.Default,
+		"auth_failures_total", "Rejected authentication attempts by reason.",
+		"reason")
+	rateLimitRejections = metrics.NewCounterVec(metrics.Default,
+		"rate_limit_rejections_total", "Requests rejected by the rate limiter by route.",
+		"route")
+)
+
+// Auth failure reasons recorded in auth_failures_total
+const (
+	reasonMissingKey         = "missing_key"
+	reasonInvalidKey         = "invalid_key"
+	reasonExpiredKey         = "expired_key"
+	reasonMissingToken       = "missing_token"
+	reasonInvalidToken       = "invalid_token"
+	reasonExpiredToken       = "expired_token"
+	reasonMissingCert        = "missing_cert"
+	reasonUnknownCert        = "unknown_cert"
+	reasonMalformedSignature = "malformed_signature"
+	reasonBadSignature       = "bad_signature"
+	reasonClockSkew          = "clock_skew"
+	reasonReplayedNonce      = "replayed_nonce"
+	reasonLockedOut          = "locked_out"
+	reasonInsufficientScope  = "insufficient_scope"
+	reasonLookupError        = "lookup_error"
+)
+
+// Metrics records request counts, latency, response sizes and in-flight
+// requests. Routes are labelled by the ServeMux pattern that matched, so next
+// must be the mux itself (or pass the same *http.Request through to it);
+// requests that matched no pattern are labelled "unmatched".
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpInFlight.Inc()
+		defer httpInFlight.Dec()
+
+		start := time.Now()
+		rec := recordResponse(w)
+		next.ServeHTTP(rec, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		method := methodLabel(r.Method)
+		httpRequests.With(route, method, strconv.Itoa(rec.code()/100)+"xx").Inc()
+		httpDuration.With(route, method).Observe(time.Since(start).Seconds())
+		httpResponseSize.With(route).Observe(float64(rec.bytes))
+	})
+}
+
+// methodLabel returns the method label for r.Method. Methods outside the
+// standard set are labelled OTHER, so clients can't create a series per
+// made-up method before auth has run.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
@@ -0,0 +1,19 @@
+package middleware
+
+import "testing"
+
+func TestMethodLabel(t *testing.T) {
+	tests := map[string]string{
+		"GET":     "GET",
+		"DELETE":  "DELETE",
+		"OPTIONS": "OPTIONS",
+		"get":     "OTHER",
+		"FOO1":    "OTHER",
+		"":        "OTHER",
+	}
+	for in, want := range tests {
+		if got := methodLabel(in); got != want {
+			t.Errorf("methodLabel(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"crypto/x509"
+	"errors"
+	"net/http"
+
+	"tiny-http/internal/apikey"
+	"tiny-http/internal/certs"
+	"tiny-http/internal/problem"
+)
+
+var errUnknownCert = errors.New("unknown client certificate")
+
+// clientCert returns the verified leaf certificate of an mTLS connection
+func clientCert(r *http.Request) (*x509.Certificate, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+	return r.TLS.VerifiedChains[0][0], true
+}
+
+// ClientCertMiddleware authenticates callers by the TLS client certificate
+// the server verified against its client CA, mapping it to an identity
+// through clients, and requires the scope the request method needs on
+// resource
+func ClientCertMiddleware(clients *certs.ClientMap, resource string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cert, ok := clientCert(r)
+			if !ok {
+				authFailures.With(reasonMissingCert).Inc()
+				problem.Write(w, r, http.StatusUnauthorized, "missing client certificate")
+				return
+			}
+			_, end := traceAuth(r, MethodMTLS)
+			client, ok := clients.Lookup(cert)
+			if !ok {
+				end(errUnknownCert)
+				authFailures.With(reasonUnknownCert).Inc()
+				problem.Write(w, r, http.StatusUnauthorized, "unknown client certificate")
+				return
+			}
+
+			end(nil)
+
+			authorize(w, r, next, Identity{
+				ID:     client.ID,
+				Name:   client.Name,
+				Tenant: client.Tenant,
+				Scopes: client.Scopes,
+				Method: MethodMTLS,
+			}, apikey.ScopeFor(resource, r.Method))
+		})
+	}
+}
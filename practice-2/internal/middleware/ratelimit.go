@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"tiny-http/internal/problem"
+	"tiny-http/internal/ratelimit"
+)
+
+// RateLimit limits requests to route with limiter. Callers are keyed by the
+// identity set by the auth middlewares, so it must run after them; requests
+// without an identity are keyed by client IP. If the backend fails the
+// request is let through.
+func RateLimit(limiter ratelimit.Limiter, route string, limit ratelimit.Limit) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, err := limiter.Allow(r.Context(), route+"|"+rateLimitKey(r), limit)
+			if err != nil {
+				logError(r, "rate limit", err, "route", route)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+			h.Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("X-RateLimit-Reset", strconv.FormatInt(res.Reset.Unix(), 10))
+
+			if !res.Allowed {
+				rateLimitRejections.With(route).Inc()
+				h.Set("Retry-After", strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds()))))
+				problem.Write(w, r, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimitKey identifies the caller: the authenticated identity if there
+// is one, the client IP otherwise
+func rateLimitKey(r *http.Request) string {
+	if id, ok := IdentityFromContext(r.Context()); ok {
+		return id.Method + ":" + id.ID
+	}
+	return "ip:" + clientIP(r)
+}
+
+// clientIP returns the host part of the connection's remote address.
+// Forwarding headers are ignored since they are set by the client.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
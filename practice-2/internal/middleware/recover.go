@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"tiny-http/internal/metrics"
+	"tiny-http/internal/problem"
+	"tiny-http/internal/requestid"
+	"tiny-http/internal/tracing"
+)
+
+var panics = metrics.NewCounterVec(metrics.Default,
+	"http_panics_total", "Panics recovered from handlers by route pattern.",
+	"route")
+
+// headerTracker notes whether the response has been started
+type headerTracker struct {
+	wrappedWriter
+	wrote bool
+}
+
+func (t *headerTracker) WriteHeader(code int) {
+	t.wrote = true
+	t.ResponseWriter.WriteHeader(code)
+}
+
+func (t *headerTracker) Write(b []byte) (int, error) {
+	t.wrote = true
+	return t.ResponseWriter.Write(b)
+}
+
+func (t *headerTracker) Flush() {
+	t.wrote = true
+	t.wrappedWriter.Flush()
+}
+
+// Recover turns a panic further down the chain into a 500 problem carrying
+// the request id and logs it with its stack. If the response had already
+// started a second one can't be written, so the connection is aborted
+// instead and the client sees a truncated response. A deliberate
+// http.ErrAbortHandler panic is passed through untouched. Recover only sees
+// what reaches its own writer, so it belongs outside middleware that
+// buffers the response, such as Compress, whose held back bytes are then
+// dropped in favour of the 500.
+func Recover(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tw := &headerTracker{wrappedWriter: wrappedWriter{w}}
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+
+				route := r.Pattern
+				if route == "" {
+					route = "unmatched"
+				}
+				panics.With(route).Inc()
+				tracing.SpanFromContext(r.Context()).SetStatus(tracing.StatusError, fmt.Sprint("panic: ", v))
+				logger.ErrorContext(r.Context(), "panic serving request",
+					"request_id", requestid.FromContext(r.Context()),
+					"trace_id", tracing.TraceIDFromContext(r.Context()),
+					"method", r.Method,
+					"path", r.URL.Path,
+					"route", route,
+					"remote", r.RemoteAddr,
+					"panic", fmt.Sprint(v),
+					"response_started", tw.wrote,
+					"stack", string(debug.Stack()),
+				)
+
+				if tw.wrote {
+					panic(http.ErrAbortHandler)
+				}
+				problem.Write(w, r, http.StatusInternalServerError, "internal error")
+			}()
+			next.ServeHTTP(tw, r)
+		})
+	}
+}
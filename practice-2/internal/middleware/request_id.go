@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+
+	"tiny-http/internal/requestid"
+)
+
+// RequestID reuses a well-formed X-Request-ID from the caller or generates
+// a new one, stores it in the request context (see requestid.FromContext)
+// and echoes it in the response. It should be the outermost middleware so
+// every log line and error body can include the id.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+
+		w.Header().Set(requestid.Header, id)
+		next.ServeHTTP(w, r.WithContext(requestid.NewContext(r.Context(), id)))
+	})
+}
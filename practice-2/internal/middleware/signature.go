@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"tiny-http/internal/apikey"
+	"tiny-http/internal/hmacauth"
+	"tiny-http/internal/problem"
+)
+
+// SignatureMiddleware authenticates requests signed with a shared key (see
+// the signing package) and requires the scope the request method needs on
+// resource
+func SignatureMiddleware(verifier *hmacauth.Verifier, resource string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, end := traceAuth(r, MethodSignature)
+			key, err := verifier.Verify(ctx, r)
+			end(err)
+			if err != nil {
+				reason, status := signatureFailure(err)
+				if status == http.StatusInternalServerError {
+					logError(r, "verify signature", err)
+					problem.Write(w, r, status, "internal error")
+					return
+				}
+				authFailures.With(reason).Inc()
+				problem.Write(w, r, status, err.Error())
+				return
+			}
+
+			authorize(w, r, next, Identity{
+				ID:     key.ID,
+				Name:   key.Name,
+				Tenant: key.Tenant,
+				Scopes: key.Scopes,
+				Method: MethodSignature,
+			}, apikey.ScopeFor(resource, r.Method))
+		})
+	}
+}
+
+// signatureFailure maps a verification error to its metric reason and
+// response status
+func signatureFailure(err error) (string, int) {
+	switch {
+	case errors.Is(err, hmacauth.ErrMissing), errors.Is(err, hmacauth.ErrMalformed):
+		return reasonMalformedSignature, http.StatusUnauthorized
+	case errors.Is(err, hmacauth.ErrUnknownKey):
+		return reasonInvalidKey, http.StatusUnauthorized
+	case errors.Is(err, hmacauth.ErrExpired):
+		return reasonExpiredKey, http.StatusUnauthorized
+	case errors.Is(err, hmacauth.ErrSkew):
+		return reasonClockSkew, http.StatusUnauthorized
+	case errors.Is(err, hmacauth.ErrSignature):
+		return reasonBadSignature, http.StatusUnauthorized
+	case errors.Is(err, hmacauth.ErrReplay):
+		return reasonReplayedNonce, http.StatusUnauthorized
+	case errors.Is(err, hmacauth.ErrBodySize):
+		return reasonMalformedSignature, http.StatusRequestEntityTooLarge
+	}
+	return reasonLookupError, http.StatusInternalServerError
+}
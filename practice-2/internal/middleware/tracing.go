@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"tiny-http/internal/requestid"
+	"tiny-http/internal/tracing"
+)
+
+// Tracing starts a server span for each request, continuing the trace in
+// an incoming traceparent header. The span is named after the route pattern
+// the mux matched, so the request it passes on must reach the mux unchanged
+// (the middleware in between may only read it). Handlers and the auth and
+// repository layers add child spans through the request context.
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if sc, ok := tracing.ParseTraceparent(r.Header.Get(tracing.TraceparentHeader)); ok {
+			ctx = tracing.ContextWithRemote(ctx, sc)
+		}
+		ctx, span := tracing.Start(ctx, r.Method, tracing.KindServer)
+		if span == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		defer span.End()
+
+		span.SetAttr("http.request.method", r.Method)
+		span.SetAttr("url.path", r.URL.Path)
+		span.SetAttr("client.address", clientIP(r))
+		span.SetAttr("user_agent.original", r.UserAgent())
+		span.SetAttr("request_id", requestid.FromContext(ctx))
+
+		r = r.WithContext(ctx)
+		rec := recordResponse(w)
+		next.ServeHTTP(rec, r)
+		status := rec.code()
+
+		if route := r.Pattern; route != "" {
+			span.SetAttr("http.route", route)
+			if !strings.Contains(route, " ") {
+				route = r.Method + " " + route
+			}
+			span.SetName(route)
+		}
+		span.SetAttr("http.response.status_code", status)
+		if status >= 500 {
+			span.SetStatus(tracing.StatusError, http.StatusText(status))
+		}
+	})
+}
+
+// traceAuth starts a child span for one credential check; end it with the
+// check's error
+func traceAuth(r *http.Request, method string) (context.Context, func(error)) {
+	ctx, span := tracing.Start(r.Context(), "auth "+method, tracing.KindInternal)
+	if span == nil {
+		return ctx, func(error) {}
+	}
+	span.SetAttr("auth.method", method)
+	return ctx, func(err error) {
+		if err != nil {
+			span.SetAttr("auth.error", err.Error())
+		}
+		span.End()
+	}
+}
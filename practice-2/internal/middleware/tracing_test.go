@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tiny-http/internal/tracing"
+)
+
+func TestObserversShareOneRecorder(t *testing.T) {
+	tr := tracing.NewTracer(tracing.NewWriterExporter(io.Discard))
+	tracing.SetDefault(tr)
+	defer tr.Close()
+
+	var inner http.ResponseWriter
+	h := NewChain(Tracing, AccessLog(slog.New(slog.NewTextHandler(io.Discard, nil))), Metrics).
+		Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			inner = w
+			w.WriteHeader(http.StatusTeapot)
+		}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	sr, ok := inner.(*statusRecorder)
+	if !ok {
+		t.Fatalf("handler got %T, want *statusRecorder", inner)
+	}
+	if sr.ResponseWriter != rec {
+		t.Errorf("handler's writer wraps %T, want the server's writer directly", sr.ResponseWriter)
+	}
+	if sr.code() != http.StatusTeapot || rec.Code != http.StatusTeapot {
+		t.Errorf("status = %d recorded, %d sent; want 418", sr.code(), rec.Code)
+	}
+}
@@ -0,0 +1,21 @@
+package middleware
+
+import "net/http"
+
+// wrappedWriter is embedded by the ResponseWriter wrappers in this package.
+// Unwrap lets http.ResponseController reach the underlying writer, and Flush
+// keeps streaming handlers working through the wrapper; wrappers that hold
+// state override it.
+type wrappedWriter struct {
+	http.ResponseWriter
+}
+
+func (w wrappedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w wrappedWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,93 @@
+// Package migrate versions the schema of the SQLite databases. Each store
+// keeps an ordered list of steps and the number it has applied is recorded
+// under its name in the schema_versions table, so a step runs exactly once
+// per database. A table rather than PRAGMA user_version lets the key and
+// user stores share one database file.
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Step is one schema change, run in the transaction that records it
+type Step func(tx *sql.Tx) error
+
+// Exec returns a step running stmt
+func Exec(stmt string) Step {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(stmt)
+		return err
+	}
+}
+
+// AddColumn returns a step adding column to table, declared as decl. It
+// does nothing if the column exists, which only happens in databases
+// created before their steps were versioned.
+func AddColumn(table, column, decl string) Step {
+	return func(tx *sql.Tx) error {
+		var n int
+		err := tx.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&n)
+		if err != nil || n > 0 {
+			return err
+		}
+		_, err = tx.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + decl)
+		return err
+	}
+}
+
+// Apply runs the steps of schema name that db hasn't applied yet, each in
+// its own transaction. It fails if db was migrated by a newer build that
+// knows more steps.
+func Apply(db *sql.DB, name string, steps []Step) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_versions (
+		name    TEXT PRIMARY KEY,
+		version INTEGER NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("migrate %s: %w", name, err)
+	}
+	for {
+		done, err := next(db, name, steps)
+		if err != nil {
+			return fmt.Errorf("migrate %s: %w", name, err)
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// next applies the first pending step and reports whether none was left.
+// The version is read in the same transaction so two processes opening
+// the database at once don't both run a step.
+func next(db *sql.DB, name string, steps []Step) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var version int
+	err = tx.QueryRow("SELECT version FROM schema_versions WHERE name = ?", name).Scan(&version)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	switch {
+	case version > len(steps):
+		return false, fmt.Errorf("database is at version %d, this build only knows %d", version, len(steps))
+	case version == len(steps):
+		return true, nil
+	}
+
+	if err := steps[version](tx); err != nil {
+		return false, fmt.Errorf("step %d: %w", version+1, err)
+	}
+	_, err = tx.Exec(`INSERT INTO schema_versions (name, version) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET version = excluded.version`, name, version+1)
+	if err != nil {
+		return false, err
+	}
+	return false, tx.Commit()
+}
@@ -0,0 +1,127 @@
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func version(t *testing.T, db *sql.DB, name string) int {
+	t.Helper()
+	var v int
+	if err := db.QueryRow("SELECT version FROM schema_versions WHERE name = ?", name).Scan(&v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func columns(t *testing.T, db *sql.DB, table string) []string {
+	t.Helper()
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var cols []string
+	for rows.Next() {
+		var c string
+		rows.Scan(&c)
+		cols = append(cols, c)
+	}
+	return cols
+}
+
+var steps = []Step{
+	Exec(`CREATE TABLE items (id INTEGER PRIMARY KEY)`),
+	AddColumn("items", "name", "TEXT"),
+}
+
+func TestApply(t *testing.T) {
+	db := openDB(t)
+	if err := Apply(db, "items", steps); err != nil {
+		t.Fatal(err)
+	}
+	if v := version(t, db, "items"); v != 2 {
+		t.Errorf("version = %d, want 2", v)
+	}
+	// CREATE TABLE without IF NOT EXISTS would fail if it ran again
+	if err := Apply(db, "items", steps); err != nil {
+		t.Errorf("second Apply: %v", err)
+	}
+
+	more := append(steps[:len(steps):len(steps)], AddColumn("items", "email", "TEXT"))
+	if err := Apply(db, "items", more); err != nil {
+		t.Fatal(err)
+	}
+	if v, cols := version(t, db, "items"), columns(t, db, "items"); v != 3 || len(cols) != 3 {
+		t.Errorf("after a new step: version %d, columns %v", v, cols)
+	}
+}
+
+func TestApplySchemasShareDatabase(t *testing.T) {
+	db := openDB(t)
+	other := []Step{Exec(`CREATE TABLE others (id INTEGER PRIMARY KEY)`)}
+	if err := Apply(db, "items", steps); err != nil {
+		t.Fatal(err)
+	}
+	if err := Apply(db, "others", other); err != nil {
+		t.Fatal(err)
+	}
+	if version(t, db, "items") != 2 || version(t, db, "others") != 1 {
+		t.Errorf("versions = %d and %d, want 2 and 1", version(t, db, "items"), version(t, db, "others"))
+	}
+}
+
+func TestApplyFailedStepRollsBack(t *testing.T) {
+	db := openDB(t)
+	failing := append(steps[:len(steps):len(steps)], func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`ALTER TABLE items ADD COLUMN half TEXT`); err != nil {
+			return err
+		}
+		return errors.New("boom")
+	})
+	if err := Apply(db, "items", failing); err == nil {
+		t.Fatal("Apply succeeded")
+	}
+	if v, cols := version(t, db, "items"), columns(t, db, "items"); v != 2 || len(cols) != 2 {
+		t.Errorf("after the failed step: version %d, columns %v; want 2 with the step rolled back", v, cols)
+	}
+}
+
+// Databases created before versioning have the columns but no version
+func TestApplyUnversionedDatabase(t *testing.T) {
+	db := openDB(t)
+	if _, err := db.Exec(`CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	adopt := []Step{Exec(`CREATE TABLE IF NOT EXISTS items (id INTEGER PRIMARY KEY)`), AddColumn("items", "name", "TEXT")}
+	if err := Apply(db, "items", adopt); err != nil {
+		t.Fatal(err)
+	}
+	if v := version(t, db, "items"); v != 2 {
+		t.Errorf("version = %d, want 2", v)
+	}
+}
+
+func TestApplyNewerDatabase(t *testing.T) {
+	db := openDB(t)
+	if err := Apply(db, "items", steps); err != nil {
+		t.Fatal(err)
+	}
+	if err := Apply(db, "items", steps[:1]); err == nil {
+		t.Error("an older build migrated a newer database")
+	}
+}
@@ -0,0 +1,24 @@
+package openapi
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"net/http"
+)
+
+//go:embed docs.html
+var docsHTML []byte
+
+// DocsHandler serves a self-contained HTML page that renders the document
+// at specURL. It loads nothing from other origins, so it works offline.
+func DocsHandler(specURL string) http.Handler {
+	quoted, _ := json.Marshal(specURL)
+	page := bytes.Replace(docsHTML, []byte("__SPEC_URL__"), quoted, 1)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+		w.Write(page)
+	})
+}
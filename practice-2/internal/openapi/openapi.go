@@ -0,0 +1,237 @@
+// Package openapi builds an OpenAPI 3.1 document from endpoint
+// descriptions. Schemas are generated from the Go request and response
+// types (json and validate tags), so the document follows the code.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Document is the root OpenAPI object
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+
+	errorRef *Schema
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem maps lower-case HTTP methods to operations
+type PathItem map[string]*Operation
+
+// Operation is one method on one path
+type Operation struct {
+	OperationID string                `json:"operationId,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter is a path or query parameter
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+// RequestBody describes the accepted body
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response describes one status code
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType holds the schema for one content type
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components holds the shared schemas and security schemes
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme is an apiKey, http or mutualTLS auth scheme
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// Endpoint is the input for one operation. Params, Query, Request and
+// Response are zero values of the Go types the handler uses; Params and
+// Query read `path` and `query` tags.
+type Endpoint struct {
+	Method      string
+	Path        string
+	Summary     string
+	Description string
+	Tag         string
+	Deprecated  bool
+
+	Params      any
+	Query       any
+	Request     any
+	RequestType string // defaults to application/json
+	Response    any
+	Status      int // success status, defaults to 200
+	Errors      []int
+
+	// Security lists alternative schemes; any one of them is enough
+	Security []string
+}
+
+// New returns an empty document
+func New(title, version, description string) *Document {
+	return &Document{
+		OpenAPI: "3.1.0",
+		Info:    Info{Title: title, Version: version, Description: description},
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas:         map[string]*Schema{},
+			SecuritySchemes: map[string]SecurityScheme{},
+		},
+	}
+}
+
+// SetErrorType registers the Go type of error bodies, which are sent as
+// application/problem+json. It must be called before endpoints that list
+// Errors are added.
+func (d *Document) SetErrorType(v any) {
+	d.errorRef = d.schemaFor(reflect.TypeOf(v), "")
+}
+
+// Add describes e in the document
+func (d *Document) Add(e Endpoint) {
+	op := &Operation{
+		OperationID: operationID(e.Method, e.Path),
+		Summary:     e.Summary,
+		Description: e.Description,
+		Deprecated:  e.Deprecated,
+		Responses:   map[string]Response{},
+	}
+	if e.Tag != "" {
+		op.Tags = []string{e.Tag}
+	}
+
+	op.Parameters = append(op.Parameters, d.params(e.Params, "path")...)
+	op.Parameters = append(op.Parameters, d.params(e.Query, "query")...)
+
+	if e.Request != nil {
+		ct := e.RequestType
+		if ct == "" {
+			ct = "application/json"
+		}
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]MediaType{ct: {Schema: d.schemaFor(reflect.TypeOf(e.Request), "")}},
+		}
+	}
+
+	status := e.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	ok := Response{Description: http.StatusText(status)}
+	if e.Response != nil {
+		ok.Content = map[string]MediaType{"application/json": {Schema: d.schemaFor(reflect.TypeOf(e.Response), "")}}
+	}
+	op.Responses[strconv.Itoa(status)] = ok
+
+	for _, code := range e.Errors {
+		op.Responses[strconv.Itoa(code)] = Response{
+			Description: http.StatusText(code),
+			Content:     map[string]MediaType{"application/problem+json": {Schema: d.errorRef}},
+		}
+	}
+
+	for _, name := range e.Security {
+		op.Security = append(op.Security, map[string][]string{name: {}})
+	}
+
+	item, ok2 := d.Paths[e.Path]
+	if !ok2 {
+		item = PathItem{}
+		d.Paths[e.Path] = item
+	}
+	item[strings.ToLower(e.Method)] = op
+}
+
+// params turns the tagged fields of a struct into parameters
+func (d *Document) params(v any, in string) []Parameter {
+	if v == nil {
+		return nil
+	}
+	t := reflect.TypeOf(v)
+	var out []Parameter
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get(in)
+		if name == "" {
+			continue
+		}
+		s := d.schemaFor(f.Type, f.Tag.Get("validate"))
+		out = append(out, Parameter{
+			Name:     name,
+			In:       in,
+			Required: in == "path" || hasRule(f.Tag.Get("validate"), "required"),
+			Schema:   s,
+		})
+	}
+	return out
+}
+
+var nonWord = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// operationID derives a stable id such as getUsersId from method and path
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, part := range nonWord.Split(path, -1) {
+		if part == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// Handler serves the document as JSON
+func (d *Document) Handler() http.Handler {
+	body, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		panic("openapi: " + err.Error())
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+}
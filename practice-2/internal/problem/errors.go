@@ -0,0 +1,85 @@
+package problem
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error is an error a handler can return to produce a specific problem.
+// Detail is shown to the client; Err is the underlying cause and is only
+// logged.
+type Error struct {
+	Status int
+	Type   string
+	Title  string
+	Detail string
+	Fields any
+	Err    error
+}
+
+func (e *Error) Error() string {
+	msg := http.StatusText(e.Status)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Problem converts e to the response body
+func (e *Error) Problem() Problem {
+	return Problem{Type: e.Type, Title: e.Title, Status: e.Status, Detail: e.Detail, Fields: e.Fields}
+}
+
+// New returns an error with the given status and client-visible detail
+func New(status int, detail string) *Error {
+	return &Error{Status: status, Detail: detail}
+}
+
+// BadRequest is a 400
+func BadRequest(format string, args ...any) *Error {
+	return New(http.StatusBadRequest, fmt.Sprintf(format, args...))
+}
+
+// NotFound is a 404
+func NotFound(format string, args ...any) *Error {
+	return New(http.StatusNotFound, fmt.Sprintf(format, args...))
+}
+
+// Conflict is a 409
+func Conflict(format string, args ...any) *Error {
+	return New(http.StatusConflict, fmt.Sprintf(format, args...))
+}
+
+// Validation is a 400 listing every invalid field
+func Validation(fields any) *Error {
+	return &Error{
+		Status: http.StatusBadRequest,
+		Type:   "/problems/validation",
+		Title:  "Validation failed",
+		Detail: "one or more fields are invalid",
+		Fields: fields,
+	}
+}
+
+// Internal is a 500 that hides err from the client
+func Internal(err error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Detail: "internal error", Err: err}
+}
+
+// From maps any error to an *Error; errors that are not already one become
+// an Internal error
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return Internal(err)
+}
@@ -0,0 +1,33 @@
+package problem
+
+import (
+	"log/slog"
+	"net/http"
+
+	"tiny-http/internal/requestid"
+	"tiny-http/internal/tracing"
+)
+
+// HandlerFunc is a handler that returns its error instead of writing it.
+// A returned *Error is sent as-is; any other error becomes a generic 500 and
+// is logged with the request id. Panics are left to middleware.Recover.
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+func (f HandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := f(w, r); err != nil {
+		f.fail(w, r, From(err))
+	}
+}
+
+func (f HandlerFunc) fail(w http.ResponseWriter, r *http.Request, e *Error) {
+	if e.Status >= 500 {
+		slog.ErrorContext(r.Context(), "request failed",
+			"request_id", requestid.FromContext(r.Context()),
+			"trace_id", tracing.TraceIDFromContext(r.Context()),
+			"method", r.Method,
+			"path", r.URL.Path,
+			"err", e,
+		)
+	}
+	WriteProblem(w, r, e.Problem())
+}
@@ -0,0 +1,59 @@
+// Package problem writes RFC 7807 application/problem+json error responses
+// and provides typed errors that handlers return instead of writing errors
+// themselves.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"tiny-http/internal/requestid"
+	"tiny-http/internal/tracing"
+)
+
+// ContentType is the media type of every error response
+const ContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details object. RequestID, TraceID and
+// Fields are extension members.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	TraceID   string `json:"trace_id,omitempty"`
+	Fields    any    `json:"fields,omitempty"`
+}
+
+// Write sends a problem with the given status and detail. The type is
+// about:blank and the title is the standard status text.
+func Write(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	WriteProblem(w, r, Problem{Status: status, Detail: detail})
+}
+
+// WriteProblem fills in the defaults of p (type, title, instance and
+// request id) and sends it
+func WriteProblem(w http.ResponseWriter, r *http.Request, p Problem) {
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if p.RequestID == "" {
+		p.RequestID = requestid.FromContext(r.Context())
+	}
+	if p.TraceID == "" {
+		p.TraceID = tracing.TraceIDFromContext(r.Context())
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"tiny-http/internal/expiring"
+)
+
+// bucket is a token bucket that refills continuously
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Memory is a token bucket limiter local to this process
+type Memory struct {
+	mu sync.Mutex
+	// buckets expire once idle long enough to be full again, which depends
+	// on the limit each one was last used with
+	buckets *expiring.Map[string, *bucket]
+	now     func() time.Time
+}
+
+// NewMemory returns an empty in-memory limiter
+func NewMemory() *Memory {
+	return &Memory{buckets: expiring.New[string, *bucket](nil), now: time.Now}
+}
+
+func (m *Memory) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	capacity := float64(limit.Requests)
+	rate := capacity / limit.Period.Seconds() // tokens per second
+
+	b, ok := m.buckets.Get(key, now)
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	m.buckets.Set(key, b, now.Add(limit.Period), now)
+
+	res := Result{Limit: limit.Requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = now.Add(seconds((capacity - b.tokens) / rate))
+	return res, nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
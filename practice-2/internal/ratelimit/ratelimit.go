@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Requests per Period
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Period)
+}
+
+// ParseLimit parses limits written as "<requests>/<period>", e.g. "100/1m"
+func ParseLimit(s string) (Limit, error) {
+	n, p, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("rate limit %q: want <requests>/<period> like 100/1m", s)
+	}
+	req, err := strconv.Atoi(strings.TrimSpace(n))
+	if err != nil || req <= 0 {
+		return Limit{}, fmt.Errorf("rate limit %q: requests must be a positive integer", s)
+	}
+	period, err := time.ParseDuration(strings.TrimSpace(p))
+	if err != nil || period < time.Millisecond {
+		// the Redis limiter counts in whole-millisecond windows
+		return Limit{}, fmt.Errorf("rate limit %q: period must be a duration of at least 1ms", s)
+	}
+	return Limit{Requests: req, Period: period}, nil
+}
+
+// Result is the outcome of one Allow call
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is when the caller is back to the full allowance
+	Reset time.Time
+	// RetryAfter is how long to wait before the next request can succeed;
+	// zero when Allowed
+	RetryAfter time.Duration
+}
+
+// Limiter counts requests per key
+type Limiter interface {
+	// Allow records one request for key and reports whether it fits in limit
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Limit
+		ok   bool
+	}{
+		{"100/1m", Limit{100, time.Minute}, true},
+		{" 5 / 1h ", Limit{5, time.Hour}, true},
+		{"1/1ms", Limit{1, time.Millisecond}, true},
+		{"1/500us", Limit{}, false},
+		{"1/0s", Limit{}, false},
+		{"0/1m", Limit{}, false},
+		{"-1/1m", Limit{}, false},
+		{"100", Limit{}, false},
+		{"x/1m", Limit{}, false},
+		{"1/soon", Limit{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseLimit(%q) = %v, %v; want %v, ok %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMemoryRefill(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+	limit := Limit{Requests: 2, Period: time.Minute}
+	ctx := context.Background()
+
+	for i := range 2 {
+		if res, _ := m.Allow(ctx, "k", limit); !res.Allowed {
+			t.Fatalf("request %d denied", i+1)
+		}
+	}
+	res, _ := m.Allow(ctx, "k", limit)
+	if res.Allowed || res.RetryAfter != 30*time.Second {
+		t.Fatalf("third request = %+v, want denied with RetryAfter 30s", res)
+	}
+
+	now = now.Add(30 * time.Second)
+	if res, _ := m.Allow(ctx, "k", limit); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("after refilling one token = %+v, want allowed with 0 remaining", res)
+	}
+}
+
+// A request under a short limit must not sweep away the buckets of keys
+// under a longer one before they have refilled.
+func TestMemorySweepKeepsLongerPeriods(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+	users := Limit{Requests: 2, Period: time.Hour}
+	auth := Limit{Requests: 10, Period: time.Minute}
+	ctx := context.Background()
+
+	for range 2 {
+		m.Allow(ctx, "users:alice", users)
+	}
+	if res, _ := m.Allow(ctx, "users:alice", users); res.Allowed {
+		t.Fatal("third users request allowed, want 429")
+	}
+
+	now = now.Add(2 * time.Minute)
+	m.Allow(ctx, "auth:alice", auth)
+
+	if res, _ := m.Allow(ctx, "users:alice", users); res.Allowed {
+		t.Errorf("users bucket was reset by a sweep after 2m of a 1h period")
+	}
+
+	now = now.Add(2 * time.Hour)
+	m.Allow(ctx, "auth:bob", auth)
+	if n := m.buckets.Len(); n != 1 {
+		t.Errorf("%d buckets after a sweep, want only auth:bob's", n)
+	}
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"tiny-http/internal/redis"
+)
+
+// Redis is a sliding window limiter shared by every process using the same
+// Redis server. It keeps one counter per key and fixed window and estimates
+// the sliding count as current + previous * (unelapsed share of the window),
+// using only INCR, PEXPIRE and GET so simple stand-in servers work too.
+type Redis struct {
+	client *redis.Client
+	prefix string
+	now    func() time.Time
+}
+
+// NewRedis returns a limiter storing counters under "ratelimit:" in client
+func NewRedis(client *redis.Client) *Redis {
+	return &Redis{client: client, prefix: "ratelimit:", now: time.Now}
+}
+
+func (l *Redis) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := l.now()
+	period := limit.Period.Milliseconds()
+	window := now.UnixMilli() / period
+	elapsed := float64(now.UnixMilli()-window*period) / float64(period)
+
+	currKey := l.prefix + key + ":" + strconv.FormatInt(window, 10)
+	prevKey := l.prefix + key + ":" + strconv.FormatInt(window-1, 10)
+
+	curr, err := l.client.Int(ctx, "INCR", currKey)
+	if err != nil {
+		return Result{}, err
+	}
+	if curr == 1 {
+		// keep the counter for two windows so the next one can read it
+		if _, err := l.client.Do(ctx, "PEXPIRE", currKey, strconv.FormatInt(2*period, 10)); err != nil {
+			return Result{}, err
+		}
+	}
+
+	var prev int64
+	reply, err := l.client.Do(ctx, "GET", prevKey)
+	switch {
+	case errors.Is(err, redis.ErrNil):
+	case err != nil:
+		return Result{}, err
+	default:
+		s, _ := reply.(string)
+		prev, _ = strconv.ParseInt(s, 10, 64)
+	}
+
+	count := float64(prev)*(1-elapsed) + float64(curr)
+	windowEnd := time.UnixMilli((window + 1) * period)
+	res := Result{
+		Limit:     limit.Requests,
+		Remaining: max(0, limit.Requests-int(count)),
+		Reset:     windowEnd,
+		Allowed:   count <= float64(limit.Requests),
+	}
+	if !res.Allowed {
+		res.RetryAfter = windowEnd.Sub(now)
+	}
+	return res, nil
+}
+
+// Ping checks that Redis answers
+func (l *Redis) Ping(ctx context.Context) error {
+	return l.client.Ping(ctx)
+}
+
+// Close closes the Redis connections
+func (l *Redis) Close() error {
+	return l.client.Close()
+}
@@ -0,0 +1,106 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"tiny-http/internal/redis"
+	"tiny-http/internal/redis/redistest"
+)
+
+func newTestRedis(t *testing.T) (*Redis, *redistest.Server, *time.Time) {
+	t.Helper()
+	srv := redistest.NewServer(t, "")
+	client, err := redis.New(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewRedis(client)
+	t.Cleanup(func() { l.Close() })
+
+	// start exactly on a window boundary
+	now := time.UnixMilli(1000 * time.Minute.Milliseconds())
+	l.now = func() time.Time { return now }
+	return l, srv, &now
+}
+
+func TestRedisWindow(t *testing.T) {
+	l, srv, now := newTestRedis(t)
+	limit := Limit{Requests: 3, Period: time.Minute}
+	ctx := context.Background()
+
+	for i := range 3 {
+		res, err := l.Allow(ctx, "k", limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Allowed || res.Remaining != 2-i {
+			t.Fatalf("request %d = %+v, want allowed with %d remaining", i+1, res, 2-i)
+		}
+	}
+
+	*now = now.Add(15 * time.Second)
+	res, err := l.Allow(ctx, "k", limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allowed || res.RetryAfter != 45*time.Second {
+		t.Fatalf("fourth request = %+v, want denied with RetryAfter 45s", res)
+	}
+	if !res.Reset.Equal(time.UnixMilli(1001 * time.Minute.Milliseconds())) {
+		t.Errorf("Reset = %v, want the end of the window", res.Reset)
+	}
+
+	if got, _ := srv.Get("ratelimit:k:1000"); got != "4" {
+		t.Errorf("counter = %q, want 4", got)
+	}
+	if ttl := srv.TTL("ratelimit:k:1000"); ttl <= time.Minute || ttl > 2*time.Minute {
+		t.Errorf("counter TTL = %v, want about two windows", ttl)
+	}
+}
+
+func TestRedisSlidesIntoNextWindow(t *testing.T) {
+	l, _, now := newTestRedis(t)
+	limit := Limit{Requests: 4, Period: time.Minute}
+	ctx := context.Background()
+
+	for range 4 {
+		l.Allow(ctx, "k", limit)
+	}
+
+	// halfway through the next window the previous 4 count as 2
+	*now = now.Add(90 * time.Second)
+	for i := range 2 {
+		if res, _ := l.Allow(ctx, "k", limit); !res.Allowed {
+			t.Fatalf("request %d in the next window denied", i+1)
+		}
+	}
+	if res, _ := l.Allow(ctx, "k", limit); res.Allowed {
+		t.Errorf("request over the sliding estimate allowed: %+v", res)
+	}
+}
+
+func TestRedisKeysAreSeparate(t *testing.T) {
+	l, _, _ := newTestRedis(t)
+	limit := Limit{Requests: 1, Period: time.Minute}
+	ctx := context.Background()
+
+	if res, _ := l.Allow(ctx, "a", limit); !res.Allowed {
+		t.Fatal("first request for a denied")
+	}
+	if res, _ := l.Allow(ctx, "b", limit); !res.Allowed {
+		t.Error("first request for b denied by a's count")
+	}
+}
+
+func TestRedisUnavailable(t *testing.T) {
+	client, err := redis.New("redis://127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewRedis(client)
+	if _, err := l.Allow(context.Background(), "k", Limit{Requests: 1, Period: time.Minute}); err == nil {
+		t.Error("Allow succeeded without a server")
+	}
+}
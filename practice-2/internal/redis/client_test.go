@@ -0,0 +1,126 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"tiny-http/internal/redis"
+	"tiny-http/internal/redis/redistest"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"redis://localhost:6379", true},
+		{"redis://:secret@localhost:6379/2", true},
+		{"rediss://cache.example.com:6380", true},
+		{"redis://localhost:6379/db", false},
+		{"http://localhost:6379", false},
+		{"redis://", false},
+		{"localhost:6379", false},
+	}
+	for _, tt := range tests {
+		c, err := redis.New(tt.url)
+		if (err == nil) != tt.ok {
+			t.Errorf("New(%q) error = %v, want ok %v", tt.url, err, tt.ok)
+		}
+		if c != nil {
+			c.Close()
+		}
+	}
+}
+
+func TestClientCommands(t *testing.T) {
+	srv := redistest.NewServer(t, "")
+	c, err := redis.New(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	if err := c.Ping(ctx); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	for want := int64(1); want <= 3; want++ {
+		n, err := c.Int(ctx, "INCR", "counter")
+		if err != nil || n != want {
+			t.Fatalf("INCR = %d, %v; want %d", n, err, want)
+		}
+	}
+
+	reply, err := c.Do(ctx, "GET", "counter")
+	if err != nil || reply != "3" {
+		t.Errorf("GET counter = %#v, %v; want \"3\"", reply, err)
+	}
+	if _, err := c.Do(ctx, "GET", "missing"); !errors.Is(err, redis.ErrNil) {
+		t.Errorf("GET missing error = %v, want ErrNil", err)
+	}
+
+	var rerr redis.Error
+	if _, err := c.Do(ctx, "NOSUCHCOMMAND"); !errors.As(err, &rerr) {
+		t.Errorf("unknown command error = %v, want redis.Error", err)
+	}
+	// an error reply leaves the connection usable
+	if err := c.Ping(ctx); err != nil {
+		t.Errorf("Ping after error reply: %v", err)
+	}
+}
+
+func TestClientAuthAndSelect(t *testing.T) {
+	srv := redistest.NewServer(t, "hunter2")
+	c, err := redis.New(srv.URL + "/3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if got, want := srv.Commands(), []string{"AUTH", "SELECT", "PING"}; !slices.Equal(got, want) {
+		t.Errorf("commands = %v, want %v", got, want)
+	}
+}
+
+func TestClientWrongPassword(t *testing.T) {
+	srv := redistest.NewServer(t, "hunter2")
+	c, err := redis.New("redis://:wrong@" + srv.URL[len("redis://:hunter2@"):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var rerr redis.Error
+	if err := c.Ping(context.Background()); !errors.As(err, &rerr) {
+		t.Errorf("Ping error = %v, want redis.Error", err)
+	}
+}
+
+func TestClientReusesConnections(t *testing.T) {
+	srv := redistest.NewServer(t, "hunter2")
+	c, err := redis.New(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for range 5 {
+		if err := c.Ping(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	auths := 0
+	for _, cmd := range srv.Commands() {
+		if cmd == "AUTH" {
+			auths++
+		}
+	}
+	if auths != 1 {
+		t.Errorf("sent AUTH %d times, want once for a single pooled connection", auths)
+	}
+}
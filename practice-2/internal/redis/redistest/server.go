@@ -0,0 +1,261 @@
+// Package redistest provides an in-process stand-in for a Redis server,
+// for tests of code built on the redis client.
+package redistest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Server speaks RESP2 on a local port and implements the commands the
+// client and the rate limiter use: PING, AUTH, SELECT, GET, SET, INCR,
+// PEXPIRE and DEL. Keys honour PEXPIRE against the wall clock.
+type Server struct {
+	// URL is the redis:// URL of the server
+	URL string
+
+	ln       net.Listener
+	password string
+
+	mu       sync.Mutex
+	data     map[string]entry
+	commands []string
+	wg       sync.WaitGroup
+}
+
+type entry struct {
+	val     string
+	expires time.Time
+}
+
+// NewServer starts a server that is closed when t finishes. A non-empty
+// password makes every command but AUTH fail until the client has sent it.
+func NewServer(t testing.TB, password string) *Server {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("redistest: listen: %v", err)
+	}
+	s := &Server{
+		URL:      "redis://" + ln.Addr().String(),
+		ln:       ln,
+		password: password,
+		data:     make(map[string]entry),
+	}
+	if password != "" {
+		s.URL = "redis://:" + password + "@" + ln.Addr().String()
+	}
+	s.wg.Add(1)
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Commands returns the names of the commands received so far, in order
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// Get returns the value stored at key, if it exists and hasn't expired
+func (s *Server) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.lookup(key)
+	return e.val, ok
+}
+
+// TTL returns the time left before key expires, or zero if it has no expiry
+func (s *Server) TTL(key string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.lookup(key)
+	if !ok || e.expires.IsZero() {
+		return 0
+	}
+	return time.Until(e.expires)
+}
+
+// Close stops the listener and waits for open connections to end
+func (s *Server) Close() {
+	s.ln.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	var conns sync.WaitGroup
+	defer conns.Wait()
+
+	done := make(chan struct{})
+	defer close(done)
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		conns.Add(1)
+		go func() {
+			defer conns.Done()
+			go func() {
+				// unblock reads once the server is closed
+				<-done
+				nc.Close()
+			}()
+			s.handle(nc)
+		}()
+	}
+}
+
+func (s *Server) handle(nc net.Conn) {
+	defer nc.Close()
+	r := bufio.NewReader(nc)
+	authed := s.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				fmt.Fprintf(nc, "-ERR %s\r\n", err)
+			}
+			return
+		}
+		reply := s.exec(args, &authed)
+		if _, err := io.WriteString(nc, reply); err != nil {
+			return
+		}
+	}
+}
+
+// exec runs one command and returns its encoded reply
+func (s *Server) exec(args []string, authed *bool) string {
+	cmd := strings.ToUpper(args[0])
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands = append(s.commands, cmd)
+
+	if cmd == "AUTH" {
+		if len(args) != 2 || args[1] != s.password {
+			return "-WRONGPASS invalid password\r\n"
+		}
+		*authed = true
+		return "+OK\r\n"
+	}
+	if !*authed {
+		return "-NOAUTH Authentication required.\r\n"
+	}
+
+	switch {
+	case cmd == "PING" && len(args) == 1:
+		return "+PONG\r\n"
+	case cmd == "SELECT" && len(args) == 2:
+		return "+OK\r\n"
+	case cmd == "GET" && len(args) == 2:
+		e, ok := s.lookup(args[1])
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulk(e.val)
+	case cmd == "SET" && len(args) == 3:
+		s.data[args[1]] = entry{val: args[2]}
+		return "+OK\r\n"
+	case cmd == "INCR" && len(args) == 2:
+		e, _ := s.lookup(args[1])
+		n := int64(0)
+		if e.val != "" {
+			var err error
+			if n, err = strconv.ParseInt(e.val, 10, 64); err != nil {
+				return "-ERR value is not an integer or out of range\r\n"
+			}
+		}
+		n++
+		e.val = strconv.FormatInt(n, 10)
+		s.data[args[1]] = e
+		return ":" + e.val + "\r\n"
+	case cmd == "PEXPIRE" && len(args) == 3:
+		ms, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return "-ERR value is not an integer or out of range\r\n"
+		}
+		e, ok := s.lookup(args[1])
+		if !ok {
+			return ":0\r\n"
+		}
+		e.expires = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		s.data[args[1]] = e
+		return ":1\r\n"
+	case cmd == "DEL" && len(args) >= 2:
+		n := 0
+		for _, k := range args[1:] {
+			if _, ok := s.lookup(k); ok {
+				delete(s.data, k)
+				n++
+			}
+		}
+		return ":" + strconv.Itoa(n) + "\r\n"
+	}
+	return "-ERR unknown command or wrong number of arguments for '" + args[0] + "'\r\n"
+}
+
+// lookup returns the live entry for key, dropping it if it has expired;
+// s.mu must be held
+func (s *Server) lookup(key string) (entry, bool) {
+	e, ok := s.data[key]
+	if ok && !e.expires.IsZero() && !time.Now().Before(e.expires) {
+		delete(s.data, key)
+		return entry{}, false
+	}
+	return e, ok
+}
+
+func bulk(s string) string {
+	return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n"
+}
+
+// readCommand reads one command sent as a RESP array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	n, err := readLength(r, '*')
+	if err != nil {
+		return nil, err
+	}
+	if n < 1 {
+		return nil, errors.New("empty command")
+	}
+	args := make([]string, n)
+	for i := range args {
+		size, err := readLength(r, '$')
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func readLength(r *bufio.Reader, prefix byte) (int, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return 0, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if len(line) < 2 || line[0] != prefix {
+		return 0, fmt.Errorf("protocol error: expected %q, got %q", prefix, line)
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("protocol error: bad length %q", line)
+	}
+	return n, nil
+}
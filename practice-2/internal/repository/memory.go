@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryUserRepository keeps users in a map; data is lost on restart
+type MemoryUserRepository struct {
+	mu     sync.RWMutex
+	users  map[int64]User
+	nextID int64
+}
+
+// NewMemoryUserRepository returns an empty in-memory repository
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{users: make(map[int64]User), nextID: 1}
+}
+
+func (m *MemoryUserRepository) Get(ctx context.Context, id int64) (User, error) {
+	s, err := scopeOf(ctx)
+	if err != nil {
+		return User{}, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	u, ok := m.users[id]
+	if !ok || !s.Allows(u.Tenant) {
+		return User{}, ErrNotFound
+	}
+	return u, nil
+}
+
+func (m *MemoryUserRepository) List(ctx context.Context, limit, offset int) ([]User, error) {
+	s, err := scopeOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	all := make([]User, 0, len(m.users))
+	for _, u := range m.users {
+		if s.Allows(u.Tenant) {
+			all = append(all, u)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].ID < all[j].ID })
+
+	if offset >= len(all) {
+		return []User{}, nil
+	}
+	all = all[offset:]
+	if limit < len(all) {
+		all = all[:limit]
+	}
+	return all, nil
+}
+
+func (m *MemoryUserRepository) Create(ctx context.Context, u User) (User, error) {
+	s, err := scopeOf(ctx)
+	if err != nil {
+		return User{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u.Tenant = s.ID
+	if m.emailTaken(u.Tenant, u.Email, 0) {
+		return User{}, ErrConflict
+	}
+	u.ID = m.nextID
+	u.CreatedAt = time.Now().UTC()
+	m.nextID++
+	m.users[u.ID] = u
+	return u, nil
+}
+
+func (m *MemoryUserRepository) Update(ctx context.Context, u User) (User, error) {
+	s, err := scopeOf(ctx)
+	if err != nil {
+		return User{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.users[u.ID]
+	if !ok || !s.Allows(stored.Tenant) {
+		return User{}, ErrNotFound
+	}
+	if m.emailTaken(stored.Tenant, u.Email, u.ID) {
+		return User{}, ErrConflict
+	}
+	stored.Name = u.Name
+	stored.Email = u.Email
+	m.users[u.ID] = stored
+	return stored, nil
+}
+
+func (m *MemoryUserRepository) Delete(ctx context.Context, id int64) error {
+	s, err := scopeOf(ctx)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if u, ok := m.users[id]; !ok || !s.Allows(u.Tenant) {
+		return ErrNotFound
+	}
+	delete(m.users, id)
+	return nil
+}
+
+func (m *MemoryUserRepository) Close() error {
+	return nil
+}
+
+// emailTaken reports whether another user of tenant than self already uses
+// email. Callers must hold m.mu.
+func (m *MemoryUserRepository) emailTaken(tenant, email string, self int64) bool {
+	if email == "" {
+		return false
+	}
+	for id, u := range m.users {
+		if id != self && u.Tenant == tenant && u.Email == email {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"tiny-http/internal/migrate"
+	"tiny-http/internal/tenant"
+)
+
+// migrations bring the users table up to date; append new steps, never
+// change applied ones
+var migrations = []migrate.Step{
+	migrate.Exec(`CREATE TABLE IF NOT EXISTS users (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		name       TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`),
+	migrate.AddColumn("users", "email", "TEXT"),
+	migrate.AddColumn("users", "tenant", "TEXT NOT NULL DEFAULT 'default'"),
+	// emails used to be unique across the whole table
+	migrate.Exec(`DROP INDEX IF EXISTS idx_users_email`),
+	migrate.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_email ON users(tenant, email)`),
+}
+
+// SQLiteUserRepository stores users in a SQLite database file
+type SQLiteUserRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteUserRepository opens (or creates) the database at path and
+// migrates the users table
+func NewSQLiteUserRepository(path string) (*SQLiteUserRepository, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connect sqlite: %w", err)
+	}
+	if err := migrate.Apply(db, "users", migrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteUserRepository{db: db}, nil
+}
+
+const userColumns = "id, tenant, name, COALESCE(email, ''), created_at"
+
+// inScope restricts a query to the tenant scope; its arguments come from
+// scopeArgs
+const inScope = "(? OR tenant = ?)"
+
+func scopeArgs(s tenant.Scope) []any {
+	return []any{s.All, s.ID}
+}
+
+func scanUser(row interface{ Scan(...any) error }) (User, error) {
+	var u User
+	err := row.Scan(&u.ID, &u.Tenant, &u.Name, &u.Email, &u.CreatedAt)
+	return u, err
+}
+
+// nullable stores empty emails as NULL so the unique index ignores them
+func nullable(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// writeErr maps unique constraint violations to ErrConflict
+func writeErr(op string, err error) error {
+	var serr sqlite3.Error
+	if errors.As(err, &serr) && serr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return ErrConflict
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+func (s *SQLiteUserRepository) Get(ctx context.Context, id int64) (User, error) {
+	scope, err := scopeOf(ctx)
+	if err != nil {
+		return User{}, err
+	}
+	u, err := scanUser(s.db.QueryRowContext(ctx,
+		"SELECT "+userColumns+" FROM users WHERE id = ? AND "+inScope, append([]any{id}, scopeArgs(scope)...)...,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrNotFound
+	}
+	if err != nil {
+		return User{}, fmt.Errorf("get user %d: %w", id, err)
+	}
+	return u, nil
+}
+
+func (s *SQLiteUserRepository) List(ctx context.Context, limit, offset int) ([]User, error) {
+	scope, err := scopeOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+userColumns+" FROM users WHERE "+inScope+" ORDER BY id LIMIT ? OFFSET ?",
+		append(scopeArgs(scope), limit, offset)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("list users: %w", err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	return users, nil
+}
+
+func (s *SQLiteUserRepository) Create(ctx context.Context, u User) (User, error) {
+	scope, err := scopeOf(ctx)
+	if err != nil {
+		return User{}, err
+	}
+	u.Tenant = scope.ID
+	u.CreatedAt = time.Now().UTC()
+	res, err := s.db.ExecContext(ctx,
+		"INSERT INTO users (tenant, name, email, created_at) VALUES (?, ?, ?, ?)",
+		u.Tenant, u.Name, nullable(u.Email), u.CreatedAt,
+	)
+	if err != nil {
+		return User{}, writeErr("create user", err)
+	}
+	u.ID, err = res.LastInsertId()
+	if err != nil {
+		return User{}, fmt.Errorf("create user: %w", err)
+	}
+	return u, nil
+}
+
+func (s *SQLiteUserRepository) Update(ctx context.Context, u User) (User, error) {
+	scope, err := scopeOf(ctx)
+	if err != nil {
+		return User{}, err
+	}
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE users SET name = ?, email = ? WHERE id = ? AND "+inScope,
+		append([]any{u.Name, nullable(u.Email), u.ID}, scopeArgs(scope)...)...,
+	)
+	if err != nil {
+		return User{}, writeErr("update user", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return User{}, ErrNotFound
+	}
+	return s.Get(ctx, u.ID)
+}
+
+func (s *SQLiteUserRepository) Delete(ctx context.Context, id int64) error {
+	scope, err := scopeOf(ctx)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx, "DELETE FROM users WHERE id = ? AND "+inScope, append([]any{id}, scopeArgs(scope)...)...)
+	if err != nil {
+		return fmt.Errorf("delete user %d: %w", id, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Ping checks that the database is reachable
+func (s *SQLiteUserRepository) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *SQLiteUserRepository) Close() error {
+	return s.db.Close()
+}
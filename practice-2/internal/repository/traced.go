@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"tiny-http/internal/tenant"
+	"tiny-http/internal/tracing"
+)
+
+// TracedUserRepository records a child span for every call to the wrapped
+// repository. Not found and conflict results are expected outcomes and
+// don't mark the span failed.
+type TracedUserRepository struct {
+	repo   UserRepository
+	system string
+}
+
+// NewTracedUserRepository wraps repo; system names the backend in spans,
+// e.g. "sqlite"
+func NewTracedUserRepository(repo UserRepository, system string) *TracedUserRepository {
+	return &TracedUserRepository{repo: repo, system: system}
+}
+
+func (t *TracedUserRepository) start(ctx context.Context, op string) (context.Context, *tracing.Span) {
+	ctx, span := tracing.Start(ctx, "repository.users."+op, tracing.KindClient)
+	span.SetAttr("db.system", t.system)
+	span.SetAttr("db.operation", op)
+	if s, ok := tenant.FromContext(ctx); ok {
+		span.SetAttr("tenant.id", s.ID)
+		span.SetAttr("tenant.all", s.All)
+	}
+	return ctx, span
+}
+
+func finish(span *tracing.Span, err error) {
+	if err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrConflict) {
+		span.SetError(err)
+	}
+	span.End()
+}
+
+func (t *TracedUserRepository) Get(ctx context.Context, id int64) (User, error) {
+	ctx, span := t.start(ctx, "get")
+	span.SetAttr("user.id", strconv.FormatInt(id, 10))
+	u, err := t.repo.Get(ctx, id)
+	finish(span, err)
+	return u, err
+}
+
+func (t *TracedUserRepository) List(ctx context.Context, limit, offset int) ([]User, error) {
+	ctx, span := t.start(ctx, "list")
+	span.SetAttr("db.limit", limit)
+	span.SetAttr("db.offset", offset)
+	users, err := t.repo.List(ctx, limit, offset)
+	span.SetAttr("db.rows", len(users))
+	finish(span, err)
+	return users, err
+}
+
+func (t *TracedUserRepository) Create(ctx context.Context, u User) (User, error) {
+	ctx, span := t.start(ctx, "create")
+	u, err := t.repo.Create(ctx, u)
+	if err == nil {
+		span.SetAttr("user.id", strconv.FormatInt(u.ID, 10))
+	}
+	finish(span, err)
+	return u, err
+}
+
+func (t *TracedUserRepository) Update(ctx context.Context, u User) (User, error) {
+	ctx, span := t.start(ctx, "update")
+	span.SetAttr("user.id", strconv.FormatInt(u.ID, 10))
+	u, err := t.repo.Update(ctx, u)
+	finish(span, err)
+	return u, err
+}
+
+func (t *TracedUserRepository) Delete(ctx context.Context, id int64) error {
+	ctx, span := t.start(ctx, "delete")
+	span.SetAttr("user.id", strconv.FormatInt(id, 10))
+	err := t.repo.Delete(ctx, id)
+	finish(span, err)
+	return err
+}
+
+func (t *TracedUserRepository) Close() error {
+	return t.repo.Close()
+}
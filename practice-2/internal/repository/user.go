@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"tiny-http/internal/tenant"
+)
+
+var (
+	// ErrNotFound is returned when a user with the requested id does not exist
+	ErrNotFound = errors.New("user not found")
+	// ErrConflict is returned when a write would duplicate another user's email
+	ErrConflict = errors.New("email already in use")
+)
+
+// User is a stored user record. Tenant is set from the caller's scope on
+// creation and never changes.
+type User struct {
+	ID        int64     `json:"id"`
+	Tenant    string    `json:"tenant"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserRepository persists users. Emails are optional but unique within a
+// tenant when set.
+//
+// Every method acts within the tenant.Scope in ctx and returns
+// tenant.ErrNoScope without one. Users of tenants outside the scope are
+// reported as ErrNotFound, exactly like ids that don't exist, so callers
+// can't probe other tenants' ids.
+type UserRepository interface {
+	// Get returns the user with the given id or ErrNotFound
+	Get(ctx context.Context, id int64) (User, error)
+	// List returns up to limit users ordered by id, skipping offset
+	List(ctx context.Context, limit, offset int) ([]User, error)
+	// Create assigns an id to u, stores it under the scope's tenant and
+	// returns the stored record
+	Create(ctx context.Context, u User) (User, error)
+	// Update replaces the name and email of the user with u.ID and returns
+	// the stored record
+	Update(ctx context.Context, u User) (User, error)
+	// Delete removes the user with the given id or returns ErrNotFound
+	Delete(ctx context.Context, id int64) error
+	// Close releases any resources held by the repository
+	Close() error
+}
+
+// scopeOf returns the tenant scope a repository call acts in
+func scopeOf(ctx context.Context) (tenant.Scope, error) {
+	s, ok := tenant.FromContext(ctx)
+	if !ok || s.ID == "" {
+		return tenant.Scope{}, tenant.ErrNoScope
+	}
+	return s, nil
+}
@@ -0,0 +1,121 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"tiny-http/internal/repository"
+	"tiny-http/internal/tenant"
+)
+
+// backends runs test against a fresh repository of every kind
+func backends(t *testing.T, test func(t *testing.T, repo repository.UserRepository)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, repository.NewMemoryUserRepository())
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		repo, err := repository.NewSQLiteUserRepository(filepath.Join(t.TempDir(), "users.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { repo.Close() })
+		test(t, repo)
+	})
+}
+
+func scoped(id string) context.Context {
+	return tenant.NewContext(context.Background(), tenant.Scope{ID: id})
+}
+
+func TestTenantIsolation(t *testing.T) {
+	backends(t, func(t *testing.T, repo repository.UserRepository) {
+		a, b := scoped("team-a"), scoped("team-b")
+
+		alice, err := repo.Create(a, repository.User{Name: "Alice", Email: "alice@example.com"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if alice.Tenant != "team-a" {
+			t.Fatalf("created user tenant = %q, want team-a", alice.Tenant)
+		}
+		bob, err := repo.Create(b, repository.User{Name: "Bob"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := repo.Get(b, alice.ID); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("Get of another tenant's user: err = %v, want ErrNotFound", err)
+		}
+		if _, err := repo.Update(b, repository.User{ID: alice.ID, Name: "Mallory"}); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("Update of another tenant's user: err = %v, want ErrNotFound", err)
+		}
+		if err := repo.Delete(b, alice.ID); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("Delete of another tenant's user: err = %v, want ErrNotFound", err)
+		}
+
+		users, err := repo.List(b, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 1 || users[0].ID != bob.ID {
+			t.Errorf("List for team-b = %+v, want only Bob", users)
+		}
+
+		got, err := repo.Get(a, alice.ID)
+		if err != nil || got.Name != "Alice" {
+			t.Errorf("Get by own tenant = %+v, %v; want Alice unchanged", got, err)
+		}
+	})
+}
+
+func TestEmailUniquePerTenant(t *testing.T) {
+	backends(t, func(t *testing.T, repo repository.UserRepository) {
+		a, b := scoped("team-a"), scoped("team-b")
+
+		if _, err := repo.Create(a, repository.User{Name: "A", Email: "same@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.Create(b, repository.User{Name: "B", Email: "same@example.com"}); err != nil {
+			t.Errorf("same email in another tenant: err = %v, want nil", err)
+		}
+		if _, err := repo.Create(a, repository.User{Name: "A2", Email: "same@example.com"}); !errors.Is(err, repository.ErrConflict) {
+			t.Errorf("same email in the same tenant: err = %v, want ErrConflict", err)
+		}
+	})
+}
+
+func TestAdminScopeSeesAllTenants(t *testing.T) {
+	backends(t, func(t *testing.T, repo repository.UserRepository) {
+		alice, _ := repo.Create(scoped("team-a"), repository.User{Name: "Alice"})
+		repo.Create(scoped("team-b"), repository.User{Name: "Bob"})
+
+		admin := tenant.NewContext(context.Background(), tenant.Scope{ID: tenant.Default, All: true})
+		users, err := repo.List(admin, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 2 {
+			t.Errorf("admin List = %d users, want 2", len(users))
+		}
+		if got, err := repo.Get(admin, alice.ID); err != nil || got.Tenant != "team-a" {
+			t.Errorf("admin Get = %+v, %v; want Alice in team-a", got, err)
+		}
+	})
+}
+
+func TestNoScope(t *testing.T) {
+	backends(t, func(t *testing.T, repo repository.UserRepository) {
+		ctx := context.Background()
+		if _, err := repo.Create(ctx, repository.User{Name: "Nobody"}); !errors.Is(err, tenant.ErrNoScope) {
+			t.Errorf("Create without scope: err = %v, want ErrNoScope", err)
+		}
+		if _, err := repo.List(ctx, 10, 0); !errors.Is(err, tenant.ErrNoScope) {
+			t.Errorf("List without scope: err = %v, want ErrNoScope", err)
+		}
+		if _, err := repo.Get(ctx, 1); !errors.Is(err, tenant.ErrNoScope) {
+			t.Errorf("Get without scope: err = %v, want ErrNoScope", err)
+		}
+	})
+}
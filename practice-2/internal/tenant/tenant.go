@@ -0,0 +1,52 @@
+// Package tenant carries whose data a request may touch. The auth layer
+// stores a Scope in the request context from the caller's credentials and
+// the user repositories filter every query by it, so a handler can't
+// forget to.
+package tenant
+
+import (
+	"context"
+	"errors"
+)
+
+// Default is the tenant of credentials that don't name one, so
+// deployments from before tenants existed keep a single shared tenant
+const Default = "default"
+
+// ErrNoScope is returned by repositories called without a Scope in the
+// context; they fail closed rather than fall back to every tenant
+var ErrNoScope = errors.New("no tenant scope in context")
+
+// Scope is the tenant a request acts for. New records belong to ID; with
+// All set, existing records of every tenant are visible too, as they are
+// to cross-tenant admins.
+type Scope struct {
+	ID  string
+	All bool
+}
+
+// Allows reports whether a record owned by tenant is visible in s
+func (s Scope) Allows(tenant string) bool {
+	return s.All || s.ID == tenant
+}
+
+type contextKey struct{}
+
+// NewContext returns ctx carrying s
+func NewContext(ctx context.Context, s Scope) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromContext returns the Scope stored by NewContext
+func FromContext(ctx context.Context) (Scope, bool) {
+	s, ok := ctx.Value(contextKey{}).(Scope)
+	return s, ok
+}
+
+// Name returns id, or Default if id is empty
+func Name(id string) string {
+	if id == "" {
+		return Default
+	}
+	return id
+}
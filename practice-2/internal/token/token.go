@@ -0,0 +1,201 @@
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrMalformed is returned for tokens that are not a valid HS256 JWT
+	ErrMalformed = errors.New("malformed token")
+	// ErrSignature is returned when the signature does not match
+	ErrSignature = errors.New("invalid token signature")
+	// ErrExpired is returned for tokens past their exp claim
+	ErrExpired = errors.New("token expired")
+	// ErrIssuer is returned when the iss claim is not ours
+	ErrIssuer = errors.New("invalid token issuer")
+	// ErrWrongType is returned when a refresh token is used as an access
+	// token or the other way round
+	ErrWrongType = errors.New("wrong token type")
+)
+
+// Token types carried in the typ claim
+const (
+	TypeAccess  = "access"
+	TypeRefresh = "refresh"
+)
+
+// header is the only JOSE header we issue and accept
+var header = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+var b64 = base64.RawURLEncoding
+
+// Claims is the JWT payload. Subject is the id of the API key the pair was
+// issued for, so a refresh can check the key again.
+type Claims struct {
+	ID        string `json:"jti"`
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	Name      string `json:"name,omitempty"`
+	Tenant    string `json:"tenant,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	Type      string `json:"typ"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Scopes returns the space separated scope claim as a slice
+func (c Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// Pair is an access token together with the refresh token that renews it
+type Pair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// Manager issues and verifies HS256 tokens
+type Manager struct {
+	secret     []byte
+	issuer     string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	now        func() time.Time
+}
+
+// NewManager returns a Manager signing with secret. Access tokens live for
+// accessTTL, refresh tokens for refreshTTL.
+func NewManager(secret, issuer string, accessTTL, refreshTTL time.Duration) *Manager {
+	return &Manager{
+		secret:     []byte(secret),
+		issuer:     issuer,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+		now:        time.Now,
+	}
+}
+
+// Issue creates a new access/refresh pair for subject, a caller of tenant
+func (m *Manager) Issue(subject, name, tenant string, scopes []string) (Pair, error) {
+	now := m.now()
+	base := Claims{
+		Issuer:   m.issuer,
+		Subject:  subject,
+		Name:     name,
+		Tenant:   tenant,
+		Scope:    strings.Join(scopes, " "),
+		IssuedAt: now.Unix(),
+	}
+
+	access, err := m.sign(base, TypeAccess, now.Add(m.accessTTL))
+	if err != nil {
+		return Pair{}, err
+	}
+	refresh, err := m.sign(base, TypeRefresh, now.Add(m.refreshTTL))
+	if err != nil {
+		return Pair{}, err
+	}
+	return Pair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(m.accessTTL / time.Second),
+	}, nil
+}
+
+// Verify checks the signature, issuer, expiry and type of tok
+func (m *Manager) Verify(tok, typ string) (Claims, error) {
+	parts := strings.Split(tok, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrMalformed
+	}
+	if !m.validHeader(parts[0]) {
+		return Claims{}, ErrMalformed
+	}
+
+	sig, err := b64.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, ErrMalformed
+	}
+	if !hmac.Equal(sig, m.mac(parts[0]+"."+parts[1])) {
+		return Claims{}, ErrSignature
+	}
+
+	payload, err := b64.DecodeString(parts[1])
+	if err != nil {
+		return Claims{}, ErrMalformed
+	}
+	var c Claims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return Claims{}, ErrMalformed
+	}
+
+	if c.Issuer != m.issuer {
+		return Claims{}, ErrIssuer
+	}
+	if m.now().Unix() >= c.ExpiresAt {
+		return Claims{}, ErrExpired
+	}
+	if c.Type != typ {
+		return Claims{}, ErrWrongType
+	}
+	return c, nil
+}
+
+// validHeader accepts any header that declares HS256, rejecting "none" and
+// asymmetric algorithms
+func (m *Manager) validHeader(seg string) bool {
+	raw, err := b64.DecodeString(seg)
+	if err != nil {
+		return false
+	}
+	var h struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(raw, &h); err != nil {
+		return false
+	}
+	return h.Alg == "HS256"
+}
+
+func (m *Manager) sign(c Claims, typ string, exp time.Time) (string, error) {
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+	c.ID = id
+	c.Type = typ
+	c.ExpiresAt = exp.Unix()
+
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("encode claims: %w", err)
+	}
+	unsigned := header + "." + b64.EncodeToString(payload)
+	return unsigned + "." + b64.EncodeToString(m.mac(unsigned)), nil
+}
+
+func (m *Manager) mac(s string) []byte {
+	h := hmac.New(sha256.New, m.secret)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate token id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
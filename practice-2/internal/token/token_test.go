@@ -0,0 +1,136 @@
+package token
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	secret = "0123456789abcdef0123456789abcdef"
+	issuer = "tiny-http"
+)
+
+var now = time.Unix(1_700_000_000, 0)
+
+func newManager() *Manager {
+	m := NewManager(secret, issuer, 15*time.Minute, 24*time.Hour)
+	m.now = func() time.Time { return now }
+	return m
+}
+
+// forge builds a token from a raw JOSE header and claims, signed with key
+// as HS256 whatever the header says
+func forge(t *testing.T, hdr string, c Claims, key string) string {
+	t.Helper()
+	payload, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned := b64.EncodeToString([]byte(hdr)) + "." + b64.EncodeToString(payload)
+	m := &Manager{secret: []byte(key)}
+	return unsigned + "." + b64.EncodeToString(m.mac(unsigned))
+}
+
+func validClaims() Claims {
+	return Claims{
+		ID: "1", Issuer: issuer, Subject: "key-1", Scope: "users:read",
+		Type: TypeAccess, IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Minute).Unix(),
+	}
+}
+
+func TestIssueVerify(t *testing.T) {
+	m := newManager()
+	pair, err := m.Issue("key-1", "billing", "team-a", []string{"users:read", "users:write"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pair.TokenType != "Bearer" || pair.ExpiresIn != 900 {
+		t.Errorf("pair = %+v", pair)
+	}
+
+	c, err := m.Verify(pair.AccessToken, TypeAccess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Subject != "key-1" || c.Name != "billing" || c.Tenant != "team-a" || c.Issuer != issuer {
+		t.Errorf("claims = %+v", c)
+	}
+	if got := c.Scopes(); len(got) != 2 || got[0] != "users:read" || got[1] != "users:write" {
+		t.Errorf("scopes = %v", got)
+	}
+	if c.ExpiresAt != now.Add(15*time.Minute).Unix() {
+		t.Errorf("exp = %d, want 15 minutes from now", c.ExpiresAt)
+	}
+
+	rc, err := m.Verify(pair.RefreshToken, TypeRefresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc.ExpiresAt != now.Add(24*time.Hour).Unix() || rc.ID == c.ID {
+		t.Errorf("refresh claims = %+v", rc)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	m := newManager()
+	pair, err := m.Issue("key-1", "billing", "", []string{"users:read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(pair.AccessToken, ".")
+
+	hs256 := `{"alg":"HS256","typ":"JWT"}`
+	expired := validClaims()
+	expired.ExpiresAt = now.Unix()
+	otherIssuer := validClaims()
+	otherIssuer.Issuer = "someone-else"
+	admin := validClaims()
+	admin.Scope = "users:read users:write tenants:admin"
+	tamperedPayload, _ := json.Marshal(admin)
+
+	tests := []struct {
+		name string
+		tok  string
+		typ  string
+		want error
+	}{
+		{"alg none", b64.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + parts[1] + ".", TypeAccess, ErrMalformed},
+		{"alg none signed", forge(t, `{"alg":"none","typ":"JWT"}`, validClaims(), secret), TypeAccess, ErrMalformed},
+		{"alg RS256", forge(t, `{"alg":"RS256","typ":"JWT"}`, validClaims(), secret), TypeAccess, ErrMalformed},
+		{"no alg", forge(t, `{"typ":"JWT"}`, validClaims(), secret), TypeAccess, ErrMalformed},
+		{"two segments", parts[0] + "." + parts[1], TypeAccess, ErrMalformed},
+		{"tampered payload", parts[0] + "." + b64.EncodeToString(tamperedPayload) + "." + parts[2], TypeAccess, ErrSignature},
+		{"tampered signature", parts[0] + "." + parts[1] + "." + b64.EncodeToString([]byte("not the signature")), TypeAccess, ErrSignature},
+		{"signature not base64", parts[0] + "." + parts[1] + ".!!!", TypeAccess, ErrMalformed},
+		{"other secret", forge(t, hs256, validClaims(), "another secret, also 32 chars long"), TypeAccess, ErrSignature},
+		{"expired", forge(t, hs256, expired, secret), TypeAccess, ErrExpired},
+		{"wrong issuer", forge(t, hs256, otherIssuer, secret), TypeAccess, ErrIssuer},
+		{"refresh as access", pair.RefreshToken, TypeAccess, ErrWrongType},
+		{"access as refresh", pair.AccessToken, TypeRefresh, ErrWrongType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := m.Verify(tt.tok, tt.typ); !errors.Is(err, tt.want) {
+				t.Errorf("Verify error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyExpiresWithTime(t *testing.T) {
+	m := newManager()
+	pair, err := m.Issue("key-1", "billing", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.now = func() time.Time { return now.Add(15 * time.Minute) }
+	if _, err := m.Verify(pair.AccessToken, TypeAccess); !errors.Is(err, ErrExpired) {
+		t.Errorf("access token at exp: error = %v, want ErrExpired", err)
+	}
+	if _, err := m.Verify(pair.RefreshToken, TypeRefresh); err != nil {
+		t.Errorf("refresh token before its exp: %v", err)
+	}
+}
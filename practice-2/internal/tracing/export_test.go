@@ -0,0 +1,151 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSpans() []SpanData {
+	start := time.Unix(1_700_000_000, 123_456_789)
+	root := SpanData{
+		Name:    "GET /users/{id}",
+		Kind:    KindServer,
+		TraceID: TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:  SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		Start:   start,
+		End:     start.Add(1500 * time.Microsecond),
+		Attributes: map[string]any{
+			"http.response.status_code": 500,
+			"http.route":                "/users/{id}",
+			"retry":                     false,
+			"ratio":                     0.5,
+		},
+		Status:        StatusError,
+		StatusMessage: "Internal Server Error",
+	}
+	child := SpanData{
+		Name:         "users.get",
+		Kind:         KindClient,
+		TraceID:      root.TraceID,
+		SpanID:       SpanID{0x53, 0x99, 0x5c, 0x3f, 0x42, 0xcd, 0x8a, 0xd8},
+		ParentSpanID: root.SpanID,
+		Start:        start.Add(100 * time.Microsecond),
+		End:          start.Add(900 * time.Microsecond),
+		Attributes:   map[string]any{"db.rows": int64(1)},
+	}
+	return []SpanData{root, child}
+}
+
+// The expected body follows the OTLP/HTTP JSON encoding: lowerCamelCase
+// field names, trace and span ids as lowercase hex rather than base64, enums
+// as integers and 64-bit integers as decimal strings.
+const wantOTLP = `{
+  "resourceSpans": [{
+    "resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "tiny-http"}}]},
+    "scopeSpans": [{
+      "scope": {"name": "tiny-http/internal/tracing"},
+      "spans": [
+        {
+          "traceId": "4bf92f3577b34da6a3ce929d0e0e4736",
+          "spanId": "00f067aa0ba902b7",
+          "name": "GET /users/{id}",
+          "kind": 2,
+          "startTimeUnixNano": "1700000000123456789",
+          "endTimeUnixNano": "1700000000124956789",
+          "attributes": [
+            {"key": "http.response.status_code", "value": {"intValue": "500"}},
+            {"key": "http.route", "value": {"stringValue": "/users/{id}"}},
+            {"key": "ratio", "value": {"doubleValue": 0.5}},
+            {"key": "retry", "value": {"boolValue": false}}
+          ],
+          "status": {"code": 2, "message": "Internal Server Error"}
+        },
+        {
+          "traceId": "4bf92f3577b34da6a3ce929d0e0e4736",
+          "spanId": "53995c3f42cd8ad8",
+          "parentSpanId": "00f067aa0ba902b7",
+          "name": "users.get",
+          "kind": 3,
+          "startTimeUnixNano": "1700000000123556789",
+          "endTimeUnixNano": "1700000000124356789",
+          "attributes": [{"key": "db.rows", "value": {"intValue": "1"}}],
+          "status": {}
+        }
+      ]
+    }]
+  }]
+}`
+
+func TestOTLPExporter(t *testing.T) {
+	var (
+		gotPath, gotType string
+		gotBody          []byte
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotType = r.URL.Path, r.Header.Get("Content-Type")
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{}`)
+	}))
+	defer collector.Close()
+
+	exp := NewOTLPExporter(collector.URL, "tiny-http")
+	defer exp.Close()
+	if err := exp.Export(context.Background(), testSpans()); err != nil {
+		t.Fatal(err)
+	}
+
+	if gotPath != "/v1/traces" || gotType != "application/json" {
+		t.Errorf("request = %s with %q, want /v1/traces with application/json", gotPath, gotType)
+	}
+	var got, want any
+	if err := json.Unmarshal(gotBody, &got); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	if err := json.Unmarshal([]byte(wantOTLP), &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("body =\n%s\nwant\n%s", gotBody, wantOTLP)
+	}
+}
+
+func TestOTLPExporterRejected(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer collector.Close()
+
+	exp := NewOTLPExporter(collector.URL, "tiny-http")
+	err := exp.Export(context.Background(), testSpans())
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("Export error = %v, want the collector's 400", err)
+	}
+}
+
+func TestWriterExporter(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewWriterExporter(&buf).Export(context.Background(), testSpans()); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("wrote %d lines, want one per span", len(lines))
+	}
+
+	var child jsonSpan
+	if err := json.Unmarshal([]byte(lines[1]), &child); err != nil {
+		t.Fatal(err)
+	}
+	if child.ParentSpanID != "00f067aa0ba902b7" || child.Kind != "client" || child.DurationMS != 0.8 {
+		t.Errorf("child line = %s", lines[1])
+	}
+}
@@ -0,0 +1,151 @@
+package tracing
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Exporter sends finished spans somewhere
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+	Close() error
+}
+
+// Batching limits: spans are exported when batchSize have queued or every
+// batchInterval, and dropped once queueSize are waiting
+const (
+	batchSize     = 256
+	batchInterval = 5 * time.Second
+	queueSize     = 4096
+)
+
+// Tracer starts spans and exports them in batches from a background
+// goroutine. A nil *Tracer starts no spans.
+type Tracer struct {
+	exporter Exporter
+	queue    chan SpanData
+	stop     chan struct{}
+	done     chan struct{}
+	dropped  atomic.Int64
+	once     sync.Once
+}
+
+// NewTracer starts a tracer exporting to exporter
+func NewTracer(exporter Exporter) *Tracer {
+	t := &Tracer{
+		exporter: exporter,
+		queue:    make(chan SpanData, queueSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go t.loop()
+	return t
+}
+
+var defaultTracer atomic.Pointer[Tracer]
+
+// SetDefault makes t the tracer used by Start
+func SetDefault(t *Tracer) {
+	defaultTracer.Store(t)
+}
+
+// Start begins a span under the default tracer; see Tracer.Start
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	return defaultTracer.Load().Start(ctx, name, kind)
+}
+
+// Start begins a span as a child of the current span in ctx, or of a remote
+// parent set with ContextWithRemote, or as the root of a new trace. Unsampled
+// remote parents are honoured: their descendants are propagated but not
+// exported. The returned context carries the new span.
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	s := &Span{tracer: t, name: name, kind: kind, start: time.Now(), attrs: map[string]any{}}
+	switch parent := SpanFromContext(ctx); {
+	case parent != nil:
+		s.sc = SpanContext{TraceID: parent.sc.TraceID, Sampled: parent.sc.Sampled}
+		s.parent = parent.sc.SpanID
+	default:
+		if remote, ok := ctx.Value(remoteKey{}).(SpanContext); ok {
+			s.sc = SpanContext{TraceID: remote.TraceID, Sampled: remote.Sampled}
+			s.parent = remote.SpanID
+		} else {
+			s.sc = SpanContext{TraceID: newTraceID(), Sampled: true}
+		}
+	}
+	s.sc.SpanID = newSpanID()
+	return ContextWithSpan(ctx, s), s
+}
+
+func (t *Tracer) enqueue(s SpanData) {
+	select {
+	case t.queue <- s:
+	default:
+		t.dropped.Add(1)
+	}
+}
+
+func (t *Tracer) loop() {
+	defer close(t.done)
+	tick := time.NewTicker(batchInterval)
+	defer tick.Stop()
+
+	batch := make([]SpanData, 0, batchSize)
+	export := func() {
+		if n := t.dropped.Swap(0); n > 0 {
+			slog.Warn("tracing queue full, spans dropped", "count", n)
+		}
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := t.exporter.Export(ctx, batch); err != nil {
+			slog.Warn("export spans", "err", err, "count", len(batch))
+		}
+		cancel()
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case s := <-t.queue:
+			batch = append(batch, s)
+			if len(batch) >= batchSize {
+				export()
+			}
+		case <-tick.C:
+			export()
+		case <-t.stop:
+			for {
+				select {
+				case s := <-t.queue:
+					batch = append(batch, s)
+					if len(batch) >= batchSize {
+						export()
+					}
+				default:
+					export()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Close exports the queued spans and closes the exporter. Spans ended
+// afterwards are dropped.
+func (t *Tracer) Close() error {
+	var err error
+	t.once.Do(func() {
+		defaultTracer.CompareAndSwap(t, nil)
+		close(t.stop)
+		<-t.done
+		err = t.exporter.Close()
+	})
+	return err
+}
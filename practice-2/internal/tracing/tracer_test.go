@@ -0,0 +1,108 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// recordingExporter keeps every exported span
+type recordingExporter struct {
+	mu     sync.Mutex
+	spans  []SpanData
+	closed bool
+}
+
+func (e *recordingExporter) Export(ctx context.Context, spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *recordingExporter) Close() error {
+	e.closed = true
+	return nil
+}
+
+func TestTracerParents(t *testing.T) {
+	exp := &recordingExporter{}
+	tr := NewTracer(exp)
+
+	ctx, root := tr.Start(context.Background(), "root", KindServer)
+	_, child := tr.Start(ctx, "child", KindInternal)
+	child.SetAttr("db.system", "sqlite")
+	child.End()
+	root.SetStatus(StatusError, "failed")
+	root.End()
+	root.End() // a second End is ignored
+
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !exp.closed {
+		t.Error("Close didn't close the exporter")
+	}
+	if len(exp.spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(exp.spans))
+	}
+
+	c, r := exp.spans[0], exp.spans[1]
+	if r.Name != "root" || c.Name != "child" {
+		t.Fatalf("export order = %s, %s; want child, root", c.Name, r.Name)
+	}
+	if c.TraceID != r.TraceID {
+		t.Error("child is in a different trace")
+	}
+	if c.ParentSpanID != r.SpanID || !r.ParentSpanID.IsZero() {
+		t.Errorf("parents = %s, %s; want child under root and root without one", c.ParentSpanID, r.ParentSpanID)
+	}
+	if c.Attributes["db.system"] != "sqlite" {
+		t.Errorf("child attributes = %v", c.Attributes)
+	}
+	if r.Status != StatusError || r.StatusMessage != "failed" || r.Kind != KindServer {
+		t.Errorf("root = %+v", r)
+	}
+	if r.End.Before(r.Start) {
+		t.Error("root ends before it starts")
+	}
+}
+
+func TestTracerRemoteParent(t *testing.T) {
+	exp := &recordingExporter{}
+	tr := NewTracer(exp)
+
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, span := tr.Start(ContextWithRemote(context.Background(), remote), "server", KindServer)
+	if TraceIDFromContext(ctx) != remote.TraceID.String() {
+		t.Errorf("trace id = %s, want the remote trace", TraceIDFromContext(ctx))
+	}
+	span.End()
+	tr.Close()
+
+	if len(exp.spans) != 1 || exp.spans[0].ParentSpanID != remote.SpanID {
+		t.Errorf("spans = %+v, want one under the remote span", exp.spans)
+	}
+}
+
+func TestTracerHonoursUnsampledParent(t *testing.T) {
+	exp := &recordingExporter{}
+	tr := NewTracer(exp)
+
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	ctx, span := tr.Start(ContextWithRemote(context.Background(), remote), "server", KindServer)
+	_, child := tr.Start(ctx, "child", KindInternal)
+	if child.SpanContext().Sampled {
+		t.Error("child of an unsampled parent is sampled")
+	}
+	if tp := child.SpanContext().Traceparent(); tp[len(tp)-2:] != "00" {
+		t.Errorf("propagated traceparent %q, want the sampled flag off", tp)
+	}
+	child.End()
+	span.End()
+	tr.Close()
+
+	if len(exp.spans) != 0 {
+		t.Errorf("exported %d unsampled spans", len(exp.spans))
+	}
+}
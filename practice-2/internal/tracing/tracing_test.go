@@ -0,0 +1,86 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+)
+
+// Cases follow the W3C Trace Context spec, section 3.2 (traceparent)
+func TestParseTraceparent(t *testing.T) {
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+	tests := []struct {
+		name    string
+		header  string
+		ok      bool
+		sampled bool
+	}{
+		{"sampled", "00-" + traceID + "-" + spanID + "-01", true, true},
+		{"not sampled", "00-" + traceID + "-" + spanID + "-00", true, false},
+		{"other flags ignored", "00-" + traceID + "-" + spanID + "-09", true, true},
+		{"surrounding space", " 00-" + traceID + "-" + spanID + "-01 ", true, true},
+		{"future version", "cc-" + traceID + "-" + spanID + "-01", true, true},
+		{"future version with more fields", "cc-" + traceID + "-" + spanID + "-01-what-the-future-holds", true, true},
+
+		{"empty", "", false, false},
+		{"version ff", "ff-" + traceID + "-" + spanID + "-01", false, false},
+		{"version 00 with more fields", "00-" + traceID + "-" + spanID + "-01-extra", false, false},
+		{"version not hex", "0x-" + traceID + "-" + spanID + "-01", false, false},
+		{"uppercase trace id", "00-4BF92F3577B34DA6A3CE929D0E0E4736-" + spanID + "-01", false, false},
+		{"uppercase flags", "00-" + traceID + "-" + spanID + "-0A", false, false},
+		{"zero trace id", "00-00000000000000000000000000000000-" + spanID + "-01", false, false},
+		{"zero span id", "00-" + traceID + "-0000000000000000-01", false, false},
+		{"short trace id", "00-" + traceID[1:] + "-" + spanID + "-01", false, false},
+		{"short span id", "00-" + traceID + "-" + spanID[1:] + "-01", false, false},
+		{"non-hex span id", "00-" + traceID + "-00f067aa0ba902bz-01", false, false},
+		{"missing flags", "00-" + traceID + "-" + spanID, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, ok := ParseTraceparent(tt.header)
+			if ok != tt.ok {
+				t.Fatalf("ParseTraceparent(%q) ok = %v, want %v", tt.header, ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if sc.TraceID.String() != traceID || sc.SpanID.String() != spanID {
+				t.Errorf("ids = %s %s, want %s %s", sc.TraceID, sc.SpanID, traceID, spanID)
+			}
+			if sc.Sampled != tt.sampled {
+				t.Errorf("Sampled = %v, want %v", sc.Sampled, tt.sampled)
+			}
+		})
+	}
+}
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	for _, sampled := range []bool{true, false} {
+		sc := SpanContext{TraceID: newTraceID(), SpanID: newSpanID(), Sampled: sampled}
+		h := sc.Traceparent()
+		if len(h) != 55 {
+			t.Errorf("Traceparent() = %q, want 55 characters", h)
+		}
+		got, ok := ParseTraceparent(h)
+		if !ok || got != sc {
+			t.Errorf("ParseTraceparent(%q) = %+v, %v; want %+v", h, got, ok, sc)
+		}
+	}
+}
+
+func TestNilSpanIsSafe(t *testing.T) {
+	var tr *Tracer
+	ctx, span := tr.Start(context.Background(), "op", KindInternal)
+	if span != nil {
+		t.Fatal("nil tracer started a span")
+	}
+	span.SetAttr("k", "v")
+	span.SetName("renamed")
+	span.SetStatus(StatusError, "boom")
+	span.End()
+	if id := TraceIDFromContext(ctx); id != "" {
+		t.Errorf("TraceIDFromContext = %q without a span", id)
+	}
+}
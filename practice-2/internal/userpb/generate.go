@@ -0,0 +1,7 @@
+// Package userpb holds the Go code generated from
+// api/proto/users/v1/users.proto. Regenerate it with go generate after
+// changing the proto; protoc, protoc-gen-go and protoc-gen-go-grpc must be
+// on PATH.
+package userpb
+
+//go:generate protoc -I ../../api/proto --go_out=../.. --go_opt=module=tiny-http --go-grpc_out=../.. --go-grpc_opt=module=tiny-http users/v1/users.proto
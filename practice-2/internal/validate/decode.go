@@ -0,0 +1,169 @@
+package validate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrMalformed wraps bodies that are not a single JSON value
+	ErrMalformed = errors.New("malformed JSON body")
+	// ErrTooLarge wraps bodies over the size limit, including decompressed
+	// bodies cut off by http.MaxBytesReader
+	ErrTooLarge = errors.New("request body too large")
+)
+
+// maxBodyBytes bounds the request bodies DecodeJSON reads
+const maxBodyBytes = 1 << 20
+
+// DecodeJSON decodes the request body into dst and validates it. Unknown
+// top-level fields are reported with rule "unknown" and every mistyped value
+// with rule "type", together with any rule failures. Oversized bodies return
+// an error wrapping ErrTooLarge; empty bodies, syntax errors and trailing
+// data one wrapping ErrMalformed.
+func DecodeJSON(r *http.Request, dst any) error {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxBodyBytes+1))
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		return fmt.Errorf("%w: body exceeds %d bytes", ErrTooLarge, tooLarge.Limit)
+	case err != nil:
+		return fmt.Errorf("%w: %v", ErrMalformed, err)
+	case len(data) > maxBodyBytes:
+		return fmt.Errorf("%w: body exceeds %d bytes", ErrTooLarge, maxBodyBytes)
+	}
+	return Unmarshal(data, dst)
+}
+
+// Unmarshal is DecodeJSON for a body that has already been read
+func Unmarshal(data []byte, dst any) error {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return fmt.Errorf("%w: body is empty", ErrMalformed)
+	}
+	if !json.Valid(data) {
+		// json.Valid also rejects trailing data; decode to get a useful message
+		var v any
+		dec := json.NewDecoder(bytes.NewReader(data))
+		if err := dec.Decode(&v); err != nil {
+			return fmt.Errorf("%w: %v", ErrMalformed, err)
+		}
+		return fmt.Errorf("%w: unexpected data after JSON value", ErrMalformed)
+	}
+
+	errs := memberErrors(data, dst)
+	if err := json.Unmarshal(data, dst); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if !errors.As(err, &typeErr) {
+			return fmt.Errorf("%w: %v", ErrMalformed, err)
+		}
+		// encoding/json returns only the first type error; memberErrors
+		// found them all unless dst isn't a struct
+		if !slices.ContainsFunc(errs, func(e FieldError) bool { return e.Rule == "type" }) {
+			errs = append(errs, FieldError{Field: typeErr.Field, Rule: "type", Param: typeErr.Type.String()})
+		}
+	}
+	return join(errs, Struct(dst))
+}
+
+// memberErrors checks each top-level member of a JSON object decoded into
+// the struct dst points to on its own. Members dst has no field for are
+// reported with rule "unknown", values that don't fit their field's type
+// with rule "type".
+func memberErrors(data []byte, dst any) []FieldError {
+	rt := reflect.TypeOf(dst)
+	for rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+	if rt.Kind() != reflect.Struct {
+		return nil
+	}
+	var members map[string]json.RawMessage
+	if json.Unmarshal(data, &members) != nil {
+		return nil
+	}
+
+	fields := make(map[string]reflect.StructField, rt.NumField())
+	for i := 0; i < rt.NumField(); i++ {
+		if sf := rt.Field(i); sf.IsExported() {
+			fields[strings.ToLower(fieldName(sf))] = sf
+		}
+	}
+	var errs []FieldError
+	for name, raw := range members {
+		// encoding/json matches member names case-insensitively
+		sf, ok := fields[strings.ToLower(name)]
+		if !ok {
+			errs = append(errs, FieldError{Field: name, Rule: "unknown"})
+			continue
+		}
+		var typeErr *json.UnmarshalTypeError
+		if err := json.Unmarshal(raw, reflect.New(sf.Type).Interface()); errors.As(err, &typeErr) {
+			field := fieldName(sf)
+			if typeErr.Field != "" {
+				field += "." + typeErr.Field
+			}
+			errs = append(errs, FieldError{Field: field, Rule: "type", Param: typeErr.Type.String()})
+		}
+	}
+	slices.SortFunc(errs, func(a, b FieldError) int { return strings.Compare(a.Field, b.Field) })
+	return errs
+}
+
+// Query fills the string and integer fields of the struct dst points to
+// from their `query` tags and validates it. Unparsable numbers are reported
+// with rule "type"; unknown parameters are ignored.
+func Query(values url.Values, dst any) error {
+	rv := reflect.ValueOf(dst).Elem()
+	rt := rv.Type()
+
+	var errs []FieldError
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		name := sf.Tag.Get("query")
+		if name == "" || !values.Has(name) {
+			continue
+		}
+		raw := values.Get(name)
+		f := rv.Field(i)
+		switch f.Kind() {
+		case reflect.String:
+			f.SetString(raw)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || f.OverflowInt(n) {
+				errs = append(errs, FieldError{Field: name, Rule: "type", Param: "integer"})
+				continue
+			}
+			f.SetInt(n)
+		default:
+			panic(fmt.Sprintf("validate: query field %s has unsupported kind %s", sf.Name, f.Kind()))
+		}
+	}
+	return join(errs, Struct(dst))
+}
+
+// join merges decoding problems with the result of Struct, dropping rule
+// failures for fields that already failed to decode
+func join(errs []FieldError, structErr error) error {
+	var verr *Error
+	if errors.As(structErr, &verr) {
+		for _, f := range verr.Fields {
+			if !slices.ContainsFunc(errs, func(e FieldError) bool { return e.Field == f.Field }) {
+				errs = append(errs, f)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return &Error{Fields: errs}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package validate
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type address struct {
+	Zip string `json:"zip"`
+}
+
+type person struct {
+	Name    string  `json:"name" validate:"required,max=10"`
+	Age     int     `json:"age" validate:"min=0"`
+	Active  bool    `json:"active"`
+	Address address `json:"address"`
+}
+
+func TestUnmarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"valid", `{"name":"Alice","age":30,"active":true,"address":{"zip":"12345"}}`, nil},
+		{"member names ignore case", `{"Name":"Alice"}`, nil},
+		{"unknown fields", `{"name":"Alice","role":"admin","Admin":true}`, []string{"Admin unknown", "role unknown"}},
+		{"every type error", `{"name":5,"age":"thirty","active":"yes"}`,
+			[]string{"active type", "age type", "name type"}},
+		{"nested type error", `{"name":"Alice","address":{"zip":12345}}`, []string{"address.zip type"}},
+		{"type and rule errors", `{"age":"old","extra":1}`, []string{"age type", "extra unknown", "name required"}},
+		{"type error replaces the rule failure", `{"name":false}`, []string{"name type"}},
+		{"rule errors", `{"name":"Bartholomew","age":-1}`, []string{"name max", "age min"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p person
+			if got := failures(t, Unmarshal([]byte(tt.body), &p)); !slices.Equal(got, tt.want) {
+				t.Errorf("failures = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalMalformed(t *testing.T) {
+	for _, body := range []string{"", "  ", `{"name":`, `{"name":"Alice"} {}`, `{"name":"Alice"}x`} {
+		var p person
+		if err := Unmarshal([]byte(body), &p); !errors.Is(err, ErrMalformed) {
+			t.Errorf("Unmarshal(%q) = %v, want ErrMalformed", body, err)
+		}
+	}
+}
+
+func TestUnmarshalNonStruct(t *testing.T) {
+	var n []int
+	if got := failures(t, Unmarshal([]byte(`[1,"two",3]`), &n)); !slices.Equal(got, []string{"1 type"}) {
+		t.Errorf("failures = %q, want a type error for element 1", got)
+	}
+	var v any
+	if err := Unmarshal([]byte(`{"anything":[1,2]}`), &v); err != nil {
+		t.Errorf("decoding into any: %v", err)
+	}
+}
+
+func TestDecodeJSONTooLarge(t *testing.T) {
+	body := `{"name":"` + strings.Repeat("a", maxBodyBytes) + `"}`
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	var p person
+	if err := DecodeJSON(r, &p); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("DecodeJSON = %v, want ErrTooLarge", err)
+	}
+
+	// a decompressed body cut off by http.MaxBytesReader
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"Alice"}`))
+	r.Body = http.MaxBytesReader(httptest.NewRecorder(), r.Body, 4)
+	if err := DecodeJSON(r, &p); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("DecodeJSON past MaxBytesReader = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	type page struct {
+		Limit  int    `query:"limit" validate:"min=1,max=100"`
+		Offset int    `query:"offset" validate:"min=0"`
+		Sort   string `query:"sort" validate:"enum=name|email"`
+	}
+
+	q := page{Limit: 50}
+	if err := Query(url.Values{"offset": {"10"}, "other": {"x"}}, &q); err != nil || q.Limit != 50 || q.Offset != 10 {
+		t.Errorf("Query = %+v, %v; want the default limit and offset 10", q, err)
+	}
+
+	q = page{}
+	err := Query(url.Values{"limit": {"lots"}, "offset": {"-1"}, "sort": {"age"}}, &q)
+	if got, want := failures(t, err), []string{"limit type", "offset min", "sort enum"}; !slices.Equal(got, want) {
+		t.Errorf("failures = %q, want %q", got, want)
+	}
+}
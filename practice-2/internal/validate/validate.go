@@ -0,0 +1,171 @@
+// Package validate checks request structs against rules declared in
+// `validate` struct tags and decodes JSON bodies strictly.
+//
+// Rules are separated by commas:
+//
+//	required     the field must not be the zero value
+//	min=N        strings: at least N characters; numbers: at least N
+//	max=N        strings: at most N characters; numbers: at most N
+//	email        a bare address such as alice@example.com
+//	enum=a|b|c   one of the listed values
+//	regex=EXPR   matches EXPR; must be the last rule since EXPR may
+//	             contain commas
+//
+// Every rule except required is skipped for zero values, so optional
+// fields only need to be valid when present. Fields are reported by their
+// json name.
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// FieldError is one failed rule
+type FieldError struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+	Param string `json:"param,omitempty"`
+}
+
+// Error lists every failed rule of a request
+type Error struct {
+	Fields []FieldError
+}
+
+func (e *Error) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		parts[i] = f.Field + " " + f.Rule
+	}
+	return "validation failed: " + strings.Join(parts, ", ")
+}
+
+var regexCache sync.Map // string -> *regexp.Regexp
+
+// Struct validates the exported fields of the struct v points to (or is)
+// and returns an *Error listing every failure, or nil
+func Struct(v any) error {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var errs []FieldError
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		tag := sf.Tag.Get("validate")
+		if tag == "" || !sf.IsExported() {
+			continue
+		}
+		errs = append(errs, checkField(fieldName(sf), rv.Field(i), tag)...)
+	}
+	if len(errs) > 0 {
+		return &Error{Fields: errs}
+	}
+	return nil
+}
+
+func checkField(name string, v reflect.Value, tag string) []FieldError {
+	var errs []FieldError
+	fail := func(rule, param string) {
+		errs = append(errs, FieldError{Field: name, Rule: rule, Param: param})
+	}
+
+	for tag != "" {
+		var rule string
+		if strings.HasPrefix(tag, "regex=") {
+			rule, tag = tag, ""
+		} else {
+			rule, tag, _ = strings.Cut(tag, ",")
+		}
+		rule, param, _ := strings.Cut(rule, "=")
+
+		if rule == "required" {
+			if v.IsZero() {
+				fail(rule, "")
+				// the other rules would only repeat the problem
+				return errs
+			}
+			continue
+		}
+		if v.IsZero() {
+			continue
+		}
+
+		switch rule {
+		case "min", "max":
+			limit, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				panic(fmt.Sprintf("validate: %s: bad %s parameter %q", name, rule, param))
+			}
+			n, ok := size(v)
+			if !ok {
+				panic(fmt.Sprintf("validate: %s: %s needs a string or number", name, rule))
+			}
+			if (rule == "min" && n < limit) || (rule == "max" && n > limit) {
+				fail(rule, param)
+			}
+		case "email":
+			s := v.String()
+			addr, err := mail.ParseAddress(s)
+			if err != nil || addr.Address != s {
+				fail(rule, "")
+			}
+		case "enum":
+			if !slices.Contains(strings.Split(param, "|"), fmt.Sprint(v.Interface())) {
+				fail(rule, param)
+			}
+		case "regex":
+			if !compile(param).MatchString(v.String()) {
+				fail(rule, param)
+			}
+		default:
+			panic(fmt.Sprintf("validate: %s: unknown rule %q", name, rule))
+		}
+	}
+	return errs
+}
+
+// size is the character count of strings and the value of numbers
+func size(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+func compile(expr string) *regexp.Regexp {
+	if re, ok := regexCache.Load(expr); ok {
+		return re.(*regexp.Regexp)
+	}
+	re := regexp.MustCompile(expr)
+	regexCache.Store(expr, re)
+	return re
+}
+
+// fieldName is the json name of a struct field
+func fieldName(sf reflect.StructField) string {
+	if name, _, _ := strings.Cut(sf.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+	if name := sf.Tag.Get("query"); name != "" {
+		return name
+	}
+	return sf.Name
+}
@@ -0,0 +1,94 @@
+package validate
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+type signup struct {
+	Name    string  `json:"name" validate:"required,min=2,max=5"`
+	Email   string  `json:"email" validate:"email"`
+	Age     int     `json:"age" validate:"min=18,max=130"`
+	Score   float64 `json:"score" validate:"max=1.5"`
+	Plan    string  `json:"plan" validate:"enum=free|pro"`
+	Code    string  `json:"code" validate:"regex=^[A-Z]{2,3}$"`
+	Count   uint    `json:"count" validate:"required"`
+	Note    string  `json:"-" validate:"max=3"`
+	private string
+}
+
+// failures returns the field and rule of each failure in err
+func failures(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var verr *Error
+	if !errors.As(err, &verr) {
+		t.Fatalf("error = %v, want *Error", err)
+	}
+	var out []string
+	for _, f := range verr.Fields {
+		out = append(out, f.Field+" "+f.Rule)
+	}
+	return out
+}
+
+func valid() signup {
+	return signup{Name: "Alice", Email: "alice@example.com", Age: 30, Score: 1, Plan: "pro", Code: "AB", Count: 1}
+}
+
+func TestStructRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*signup)
+		want   []string
+	}{
+		{"valid", func(s *signup) {}, nil},
+		{"optional fields empty", func(s *signup) { s.Email, s.Age, s.Score, s.Plan, s.Code = "", 0, 0, "", "" }, nil},
+		{"required", func(s *signup) { s.Name = "" }, []string{"name required"}},
+		{"required number", func(s *signup) { s.Count = 0 }, []string{"count required"}},
+		{"min length", func(s *signup) { s.Name = "A" }, []string{"name min"}},
+		{"max length counts characters", func(s *signup) { s.Name = "Zoë" }, nil},
+		{"max length", func(s *signup) { s.Name = "Alexander" }, []string{"name max"}},
+		{"min number", func(s *signup) { s.Age = 17 }, []string{"age min"}},
+		{"max number", func(s *signup) { s.Age = 131 }, []string{"age max"}},
+		{"max float", func(s *signup) { s.Score = 1.6 }, []string{"score max"}},
+		{"email", func(s *signup) { s.Email = "alice" }, []string{"email email"}},
+		{"email with a name", func(s *signup) { s.Email = "Alice <alice@example.com>" }, []string{"email email"}},
+		{"enum", func(s *signup) { s.Plan = "enterprise" }, []string{"plan enum"}},
+		{"regex", func(s *signup) { s.Code = "abc" }, []string{"code regex"}},
+		{"every failure", func(s *signup) { s.Name, s.Age, s.Plan = "", 5, "gold" },
+			[]string{"name required", "age min", "plan enum"}},
+		{"unexported and untagged fields", func(s *signup) { s.private = "ignored" }, nil},
+		{"json name -", func(s *signup) { s.Note = "long" }, []string{"Note max"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := valid()
+			tt.change(&s)
+			if got := failures(t, Struct(&s)); !slices.Equal(got, tt.want) {
+				t.Errorf("failures = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStructBadTagPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("unknown rule didn't panic")
+		}
+	}()
+	Struct(&struct {
+		X string `validate:"uppercase"`
+	}{X: "x"})
+}
+
+func TestErrorMessage(t *testing.T) {
+	err := &Error{Fields: []FieldError{{Field: "name", Rule: "required"}, {Field: "age", Rule: "min", Param: "18"}}}
+	if got := err.Error(); got != "validation failed: name required, age min" {
+		t.Errorf("Error() = %q", got)
+	}
+}
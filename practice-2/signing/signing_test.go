@@ -0,0 +1,77 @@
+package signing
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCanonicalQuery(t *testing.T) {
+	a, _ := url.ParseQuery("tag=b&limit=5&tag=a&q=x+y")
+	b, _ := url.ParseQuery("q=x%20y&tag=a&limit=5&tag=b")
+	if CanonicalQuery(a) != CanonicalQuery(b) {
+		t.Errorf("canonical forms differ: %q, %q", CanonicalQuery(a), CanonicalQuery(b))
+	}
+	if got, want := CanonicalQuery(a), "limit=5&q=x+y&tag=a&tag=b"; got != want {
+		t.Errorf("CanonicalQuery = %q, want %q", got, want)
+	}
+}
+
+func TestSign(t *testing.T) {
+	at := time.Unix(1_700_000_000, 0)
+	s := &Signer{KeyID: "billing", Secret: []byte("secret"), Now: func() time.Time { return at }}
+	r := httptest.NewRequest(http.MethodPost, "/users?b=2&a=1", strings.NewReader("body"))
+	if err := s.Sign(r); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Header.Get(HeaderKeyID) != "billing" || r.Header.Get(HeaderTimestamp) != "1700000000" {
+		t.Errorf("headers = %v", r.Header)
+	}
+	if n := r.Header.Get(HeaderNonce); len(n) != 32 {
+		t.Errorf("nonce %q, want 16 random bytes in hex", n)
+	}
+	canonical := "POST\n/users\na=1&b=2\n1700000000\n" + r.Header.Get(HeaderNonce) + "\n" + BodyHash([]byte("body"))
+	if got, want := r.Header.Get(HeaderSignature), Compute([]byte("secret"), canonical); got != want {
+		t.Errorf("signature = %s, want %s", got, want)
+	}
+	if body, _ := io.ReadAll(r.Body); string(body) != "body" {
+		t.Errorf("body after signing = %q", body)
+	}
+}
+
+func TestSignRequiresKey(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/users", nil)
+	if err := (&Signer{KeyID: "billing"}).Sign(r); err == nil {
+		t.Error("signed without a secret")
+	}
+}
+
+func TestTransportLeavesRequestAlone(t *testing.T) {
+	var got *http.Request
+	tr := &Transport{
+		Signer: &Signer{KeyID: "billing", Secret: []byte("secret")},
+		Base: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			got = r
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}),
+	}
+	r := httptest.NewRequest(http.MethodGet, "http://api.example.com/users", nil)
+	if _, err := tr.RoundTrip(r); err != nil {
+		t.Fatal(err)
+	}
+	if got.Header.Get(HeaderSignature) == "" {
+		t.Error("sent request is unsigned")
+	}
+	if r.Header.Get(HeaderSignature) != "" {
+		t.Error("caller's request was modified")
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }